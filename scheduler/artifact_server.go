@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+)
+
+const (
+	ARTIFACT_SERVER_READY_TIMEOUT    = 5 * time.Second
+	ARTIFACT_SERVER_SHUTDOWN_TIMEOUT = 10 * time.Second
+	ARTIFACT_TOKEN_SIZE              = 16
+	// kept in -workdir-cache
+	ARTIFACT_SECRET_FILE = "artifact-secret"
+	// validity of self-generated certificates
+	ARTIFACT_CERT_VALIDITY = 7 * 24 * time.Hour
+)
+
+// serves artifacts to the slaves' fetchers
+// all urls contain a token signed with a secret, artifacts can't be guessed by other cluster users
+// the token only depends on the secret and the artifact's name, so slaves may cache artifacts across runs
+type ArtifactServer struct {
+	Address  string
+	Port     int
+	secret   []byte
+	mux      *http.ServeMux
+	server   *http.Server
+	listener net.Listener
+	stopped  sync.Once
+	tls      bool
+}
+
+// a nil secret is replaced by a random one, urls differ with each run then
+func NewArtifactServer(address string, port int, secret []byte) (*ArtifactServer, error) {
+	if secret == nil {
+		var err error
+		if secret, err = newArtifactSecret(); err != nil {
+			return nil, err
+		}
+	}
+	s := &ArtifactServer{
+		Address: address,
+		Port:    port,
+		secret:  secret,
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc(s.path("ready"), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	s.server = &http.Server{Handler: s.mux}
+	return s, nil
+}
+
+// serves the file at path as name
+// returns the uri for fetching it
+func (s *ArtifactServer) Serve(path, name string) string {
+	s.mux.HandleFunc(s.path(name), func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, path)
+	})
+	uri := s.url(name)
+	log.Infof("Hosting artifact '%s' at '%s'", path, uri)
+	return uri
+}
+
+// serve over https with the certificate in certFile and keyFile
+// a self-signed certificate for Address is generated without certFile
+func (s *ArtifactServer) EnableTLS(certFile, keyFile string) error {
+	var cert tls.Certificate
+	var err error
+	if certFile != "" {
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	} else {
+		cert, err = newSelfSignedCertificate(s.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to prepare artifact server certificate: %s", err)
+	}
+	s.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	s.tls = true
+	return nil
+}
+
+// starts serving and waits until the server is reachable on Address
+func (s *ArtifactServer) Start() error {
+	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", s.Address, s.Port))
+	if err != nil {
+		return fmt.Errorf("Unable to start artifact server: %s", err)
+	}
+	if s.tls {
+		l = tls.NewListener(l, s.server.TLSConfig)
+	}
+	s.listener = l
+	if s.Port == 0 {
+		s.Port = l.Addr().(*net.TCPAddr).Port
+	}
+	go func() {
+		if err := s.server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Errorln("Artifact server failed:", err)
+		}
+	}()
+	return s.waitUntilReady()
+}
+
+// stops the server once all running requests are done, safe to call more than once
+func (s *ArtifactServer) Stop() {
+	if s.listener == nil {
+		return
+	}
+	s.stopped.Do(func() {
+		log.Infoln("Stopping artifact server")
+		ctx, cancel := context.WithTimeout(context.Background(), ARTIFACT_SERVER_SHUTDOWN_TIMEOUT)
+		defer cancel()
+		if err := s.server.Shutdown(ctx); err != nil {
+			log.Errorln("Unable to stop artifact server:", err)
+		}
+	})
+}
+
+// reads the secret for signing artifact urls from path, a new one is saved there if it doesn't exist
+// the secret is only trusted if no other user can read or replace it
+func LoadArtifactSecret(path string) ([]byte, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := checkPrivate(dir, 0022); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := checkPrivate(path, 0077); err != nil {
+			return nil, err
+		}
+		if secret := bytes.TrimSpace(data); len(secret) > 0 {
+			return secret, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	secret, err := newArtifactSecret()
+	if err != nil {
+		return nil, err
+	}
+	encoded := []byte(hex.EncodeToString(secret))
+	// other users must not sign urls
+	return encoded, ioutil.WriteFile(path, encoded, 0600)
+}
+
+// private
+
+func (s *ArtifactServer) path(name string) string {
+	return fmt.Sprintf("/%s/%s", s.token(name), name)
+}
+
+func (s *ArtifactServer) token(name string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(name))
+	return hex.EncodeToString(mac.Sum(nil))[:2*ARTIFACT_TOKEN_SIZE]
+}
+
+func (s *ArtifactServer) url(name string) string {
+	scheme := "http"
+	if s.tls {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d%s", scheme, s.Address, s.Port, s.path(name))
+}
+
+// the slaves fetch from Address, so the server is checked there instead of the listener's address
+// only reachability is checked, whether slaves trust the certificate is up to them
+func (s *ArtifactServer) waitUntilReady() error {
+	client := &http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	deadline := time.Now().Add(ARTIFACT_SERVER_READY_TIMEOUT)
+	for {
+		resp, err := client.Get(s.url("ready"))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Artifact server at %s:%d is not reachable: %s", s.Address, s.Port, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// checks that path belongs to the current user and grants other users none of the permissions in mask
+func checkPrivate(path string, mask os.FileMode) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s belongs to another user, choose another -workdir-cache", path)
+	}
+	if perm := info.Mode().Perm(); perm&mask != 0 {
+		return fmt.Errorf("%s has mode %s, other users must not be able to change or read the secret", path, perm)
+	}
+	return nil
+}
+
+func newArtifactSecret() ([]byte, error) {
+	b := make([]byte, ARTIFACT_TOKEN_SIZE)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func newSelfSignedCertificate(host string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"NONE"}, CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(ARTIFACT_CERT_VALIDITY),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifactServerServesWithToken(t *testing.T) {
+	s, err := NewArtifactServer("127.0.0.1", 0, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Start())
+	uri := s.Serve("artifact_server_test.go", "workdir.tar.gz")
+	defer s.Stop()
+
+	assert.True(t, strings.HasSuffix(uri, "/"+s.token("workdir.tar.gz")+"/workdir.tar.gz"))
+	resp, err := http.Get(uri)
+	assert.Nil(t, err)
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(data), "TestArtifactServerServesWithToken")
+
+	// artifacts are not served without the token
+	resp, err = http.Get(strings.Replace(uri, s.token("workdir.tar.gz")+"/", "", 1))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestArtifactServerTokensDiffer(t *testing.T) {
+	s1, _ := NewArtifactServer("127.0.0.1", 0, nil)
+	s2, _ := NewArtifactServer("127.0.0.1", 0, nil)
+	assert.NotEqual(t, s1.token("workdir.tar.gz"), s2.token("workdir.tar.gz"))
+	assert.NotEqual(t, s1.token("workdir.tar.gz"), s1.token("other.tar.gz"))
+	assert.Len(t, s1.token("workdir.tar.gz"), 2*ARTIFACT_TOKEN_SIZE)
+}
+
+func TestArtifactServerTokensStableWithSecret(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "none-artifacts")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache", ARTIFACT_SECRET_FILE)
+
+	secret, err := LoadArtifactSecret(path)
+	assert.Nil(t, err)
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	again, err := LoadArtifactSecret(path)
+	assert.Nil(t, err)
+	assert.Equal(t, secret, again)
+
+	s1, _ := NewArtifactServer("127.0.0.1", 0, secret)
+	s2, _ := NewArtifactServer("127.0.0.1", 0, again)
+	assert.Equal(t, s1.token("workdir.tar.gz"), s2.token("workdir.tar.gz"), "urls should be cacheable across runs")
+}
+
+func TestArtifactSecretMustBePrivate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "none-artifacts")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ARTIFACT_SECRET_FILE)
+
+	_, err := LoadArtifactSecret(path)
+	assert.Nil(t, err)
+	os.Chmod(path, 0644)
+	_, err = LoadArtifactSecret(path)
+	assert.NotNil(t, err, "others could read the secret")
+
+	os.Chmod(path, 0600)
+	os.Chmod(dir, 0777)
+	_, err = LoadArtifactSecret(path)
+	assert.NotNil(t, err, "others could replace the secret")
+
+	os.Chmod(dir, 0755)
+	_, err = LoadArtifactSecret(path)
+	assert.Nil(t, err)
+}
+
+func TestArtifactServerPortInUse(t *testing.T) {
+	s1, _ := NewArtifactServer("127.0.0.1", 0, nil)
+	assert.Nil(t, s1.Start())
+	defer s1.Stop()
+
+	s2, _ := NewArtifactServer("127.0.0.1", s1.Port, nil)
+	assert.NotNil(t, s2.Start())
+}
+
+func TestArtifactServerStop(t *testing.T) {
+	s, _ := NewArtifactServer("127.0.0.1", 0, nil)
+	assert.Nil(t, s.Start())
+	uri := s.Serve("artifact_server_test.go", "workdir.tar.gz")
+
+	s.Stop()
+	s.Stop()
+	_, err := http.Get(uri)
+	assert.NotNil(t, err)
+}
+
+func TestArtifactServerSelfSignedTLS(t *testing.T) {
+	s, _ := NewArtifactServer("127.0.0.1", 0, nil)
+	assert.Nil(t, s.EnableTLS("", ""))
+	assert.Nil(t, s.Start())
+	defer s.Stop()
+	uri := s.Serve("artifact_server_test.go", "workdir.tar.gz")
+	assert.True(t, strings.HasPrefix(uri, "https://127.0.0.1:"))
+
+	_, err := http.Get(uri)
+	assert.NotNil(t, err, "self-signed certificate should not be trusted")
+
+	cert, err := x509.ParseCertificate(s.server.TLSConfig.Certificates[0].Certificate[0])
+	assert.Nil(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	resp, err := NewHttpClient(&tls.Config{RootCAs: pool}, nil).Get(uri)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestArtifactServerInvalidCertificate(t *testing.T) {
+	s, _ := NewArtifactServer("127.0.0.1", 0, nil)
+	assert.NotNil(t, s.EnableTLS("does-not-exist.pem", "does-not-exist.key"))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/golang/glog"
+)
+
+const DEFAULT_ARTIFACTS_DIR = "artifacts"
+
+// downloads files matching Pattern from the sandbox of finished tasks to Dir/<task-id>/
+type ArtifactFetcher struct {
+	Pattern string
+	Dir     string
+}
+
+// an entry of the slave's files/browse.json
+type sandboxFile struct {
+	Path string
+	Mode string
+	Size int64
+}
+
+func NewArtifactFetcher(pattern, dir string) (*ArtifactFetcher, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("Invalid artifact pattern %s: %s", pattern, err)
+	}
+	return &ArtifactFetcher{Pattern: pattern, Dir: dir}, nil
+}
+
+// a pattern without / matches files in any directory of the sandbox
+func (f *ArtifactFetcher) Matches(rel string) bool {
+	if strings.Contains(f.Pattern, "/") {
+		ok, _ := path.Match(f.Pattern, rel)
+		return ok
+	}
+	ok, _ := path.Match(f.Pattern, path.Base(rel))
+	return ok
+}
+
+// downloads all matching files of the sandbox dir on slaveUrl
+// returns the number of downloaded files
+func (f *ArtifactFetcher) Fetch(slaveUrl, dir, taskId string) (int, error) {
+	files, err := browseSandbox(slaveUrl, dir)
+	if err != nil {
+		return 0, err
+	}
+	taskDir := filepath.Join(f.Dir, taskId)
+	n := 0
+	for _, file := range files {
+		rel := strings.TrimPrefix(strings.TrimPrefix(file.Path, dir), "/")
+		if !f.Matches(rel) {
+			continue
+		}
+		// paths come from the slave, they must not point outside of the task's directory
+		target := filepath.Join(taskDir, filepath.FromSlash(rel))
+		if !strings.HasPrefix(target, taskDir+string(filepath.Separator)) {
+			return n, fmt.Errorf("Artifact %s is outside of the sandbox %s", file.Path, dir)
+		}
+		if err := downloadSandboxFile(slaveUrl, file.Path, target); err != nil {
+			return n, err
+		}
+		log.Infof("Fetched artifact %s of task %s to %s", rel, taskId, target)
+		n++
+	}
+	return n, nil
+}
+
+// private
+
+// lists all files in the sandbox dir and its subdirectories
+func browseSandbox(slaveUrl, dir string) ([]*sandboxFile, error) {
+	resp, err := httpClient.Get(fmt.Sprintf("%s/files/browse.json?path=%s", slaveUrl, url.QueryEscape(dir)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	var entries []*sandboxFile
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	files := []*sandboxFile{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Mode, "d") {
+			sub, err := browseSandbox(slaveUrl, e.Path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, sub...)
+		} else {
+			files = append(files, e)
+		}
+	}
+	return files, nil
+}
+
+func downloadSandboxFile(slaveUrl, file, target string) error {
+	resp, err := httpClient.Get(fmt.Sprintf("%s/files/download.json?path=%s", slaveUrl, url.QueryEscape(file)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serves a sandbox like the slave's files/browse.json and files/download.json
+func newSandboxServer(files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Query().Get("path")
+		switch r.URL.Path {
+		case "/files/browse.json":
+			entries := []*sandboxFile{}
+			dirs := map[string]bool{}
+			for f := range files {
+				if filepath.Dir(f) == p {
+					entries = append(entries, &sandboxFile{Path: f, Mode: "-rw-r--r--"})
+				} else if d := filepath.Dir(f); filepath.Dir(d) == p && !dirs[d] {
+					dirs[d] = true
+					entries = append(entries, &sandboxFile{Path: d, Mode: "drwxr-xr-x"})
+				}
+			}
+			json.NewEncoder(w).Encode(entries)
+		case "/files/download.json":
+			if data, ok := files[p]; ok {
+				fmt.Fprint(w, data)
+			} else {
+				http.NotFound(w, r)
+			}
+		}
+	}))
+}
+
+func TestArtifactMatches(t *testing.T) {
+	f, _ := NewArtifactFetcher("*.xml", "out")
+	assert.True(t, f.Matches("report.xml"))
+	assert.True(t, f.Matches("target/reports/report.xml"))
+	assert.False(t, f.Matches("cmd.stdout"))
+
+	f, _ = NewArtifactFetcher("target/*.jar", "out")
+	assert.True(t, f.Matches("target/none.jar"))
+	assert.False(t, f.Matches("none.jar"))
+	assert.False(t, f.Matches("lib/target/none.jar"))
+}
+
+func TestInvalidArtifactPattern(t *testing.T) {
+	_, err := NewArtifactFetcher("[", "out")
+	assert.NotNil(t, err)
+}
+
+func TestFetchArtifacts(t *testing.T) {
+	ts := newSandboxServer(map[string]string{
+		"/sandbox/cmd.stdout":              "output",
+		"/sandbox/report.xml":              "<report/>",
+		"/sandbox/target/reports/test.xml": "<test/>",
+		"/sandbox/target/none.jar":         "jar",
+	})
+	defer ts.Close()
+	dir, _ := ioutil.TempDir("", "none-artifacts")
+	defer os.RemoveAll(dir)
+
+	f, _ := NewArtifactFetcher("*.xml", dir)
+	n, err := f.Fetch(ts.URL, "/sandbox", "3")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "3", "report.xml"))
+	assert.Equal(t, "<report/>", string(data))
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "3", "target", "reports", "test.xml"))
+	assert.Equal(t, "<test/>", string(data))
+	_, err = os.Stat(filepath.Join(dir, "3", "cmd.stdout"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFetchArtifactsBrowseFailure(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	f, _ := NewArtifactFetcher("*", "out")
+	_, err := f.Fetch(ts.URL, "/sandbox", "3")
+	assert.NotNil(t, err)
+}
+
+func TestFetchArtifactsOutsideSandbox(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/files/browse.json" {
+			json.NewEncoder(w).Encode([]*sandboxFile{{Path: "/sandbox/../../escape.xml", Mode: "-rw-r--r--"}})
+		} else {
+			fmt.Fprint(w, "<escape/>")
+		}
+	}))
+	defer ts.Close()
+	dir, _ := ioutil.TempDir("", "none-artifacts")
+	defer os.RemoveAll(dir)
+
+	f, _ := NewArtifactFetcher("*.xml", filepath.Join(dir, "artifacts"))
+	n, err := f.Fetch(ts.URL, "/sandbox", "3")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, n)
+	_, err = os.Stat(filepath.Join(dir, "escape.xml"))
+	assert.True(t, os.IsNotExist(err))
+}
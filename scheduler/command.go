@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	log "github.com/golang/glog"
 	mesos "github.com/mesos/mesos-go/mesosproto"
@@ -10,21 +13,100 @@ import (
 )
 
 type Command struct {
-	Id            string
-	FrameworkId   string
-	SlaveId       string
-	Cmd           string
-	CpuReq        float64
-	MemReq        float64
-	ContainerInfo *mesos.ContainerInfo
-	Uris          []*mesos.CommandInfo_URI
-	Status        *mesos.TaskStatus
-	StdoutPailer  *Pailer
-	StderrPailer  *Pailer
+	Id             string
+	FrameworkId    string
+	SlaveId        string
+	Hostname       string
+	Attributes     []*mesos.Attribute
+	Cmd            string
+	Name           string
+	CpuReq         float64
+	MemReq         float64
+	DiskReq        float64
+	Resources      map[string]float64
+	Ports          int
+	Allocated      []*mesos.Resource
+	AllocatedPorts []uint64
+	Env            map[string]string
+	Constraints    Constraint
+	Timeout        time.Duration
+	ContainerInfo  *mesos.ContainerInfo
+	Uris           []*mesos.CommandInfo_URI
+	Status         *mesos.TaskStatus
+	Attempt        int
+	ExitCode       int
+	SlaveUrl       string
+	Directory      string
+	StdoutPailer   *Pailer
+	StderrPailer   *Pailer
+	stdoutOffset   int
+	stderrOffset   int
+	restored       bool
+	timer          *time.Timer
+	timedOut       int32
 }
 
-func (c *Command) MatchesResources(cpu, mem float64) bool {
-	return c.CpuReq <= cpu && c.MemReq <= mem
+// returns all requested scalar resources by name
+func (c *Command) ScalarRequests() map[string]float64 {
+	res := map[string]float64{"cpus": c.CpuReq, "mem": c.MemReq}
+	if c.DiskReq > 0 {
+		res["disk"] = c.DiskReq
+	}
+	for name, v := range c.Resources {
+		res[name] = v
+	}
+	return res
+}
+
+// matches the command's own constraints
+func (c *Command) MatchesConstraints(offer *mesos.Offer, placed []*Command) bool {
+	return c.Constraints == nil || c.Constraints.Match(offer, placed)
+}
+
+func (c *Command) GetName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return "none-task-" + c.Id
+}
+
+// returns a copy of the command for launching it again
+func (c *Command) NewAttempt() *Command {
+	a := *c
+	a.Id = ""
+	a.SlaveId = ""
+	a.Hostname = ""
+	a.Attributes = nil
+	a.Allocated = nil
+	a.AllocatedPorts = nil
+	a.Status = nil
+	a.ExitCode = 0
+	a.SlaveUrl = ""
+	a.Directory = ""
+	a.StdoutPailer = nil
+	a.StderrPailer = nil
+	a.stdoutOffset = 0
+	a.stderrOffset = 0
+	a.restored = false
+	a.timer = nil
+	a.timedOut = 0
+	a.Attempt++
+	return &a
+}
+
+// checks if the command's task reached a terminal state
+func (c *Command) HasEnded() bool {
+	return IsEndState(c.Status.GetState())
+}
+
+// terminal task states, a task in one of them never changes its state again
+func IsEndState(state mesos.TaskState) bool {
+	switch state {
+	case mesos.TaskState_TASK_FINISHED, mesos.TaskState_TASK_FAILED,
+		mesos.TaskState_TASK_KILLED, mesos.TaskState_TASK_LOST, mesos.TaskState_TASK_ERROR:
+		return true
+	}
+	return false
 }
 
 func (c *Command) GetCommandInfo() *mesos.CommandInfo {
@@ -32,36 +114,80 @@ func (c *Command) GetCommandInfo() *mesos.CommandInfo {
 	shell := false
 	var args []string
 
+	// record the command's exit code in the sandbox, see FetchExitCode()
 	if c.ContainerInfo == nil {
-		args = []string{"", "-c", fmt.Sprintf("( %s ) > cmd.stdout 2> cmd.stderr", c.Cmd)}
+		args = []string{"", "-c", fmt.Sprintf("( %s ) > cmd.stdout 2> cmd.stderr; rc=$?; echo $rc > cmd.exitcode; exit $rc", c.Cmd)}
 	} else {
-		args = []string{"-c", fmt.Sprintf("( %s ) > /${MESOS_SANDBOX}/cmd.stdout 2> /${MESOS_SANDBOX}/cmd.stderr", c.Cmd)}
+		args = []string{"-c", fmt.Sprintf("( %s ) > /${MESOS_SANDBOX}/cmd.stdout 2> /${MESOS_SANDBOX}/cmd.stderr; rc=$?; echo $rc > /${MESOS_SANDBOX}/cmd.exitcode; exit $rc", c.Cmd)}
 	}
 
 	return &mesos.CommandInfo{
-		Shell:     &shell,
-		Value:     &value,
-		Arguments: args,
-		Uris:      c.Uris,
+		Shell:       &shell,
+		Value:       &value,
+		Arguments:   args,
+		Uris:        c.Uris,
+		Environment: newEnvironment(c.environment()),
 	}
 }
 
+// returns the allocated resources, or the requested ones without role before allocation
 func (c *Command) GetResources() []*mesos.Resource {
-	return []*mesos.Resource{
+	if len(c.Allocated) > 0 {
+		return c.Allocated
+	}
+	res := []*mesos.Resource{
 		util.NewScalarResource("cpus", c.CpuReq),
 		util.NewScalarResource("mem", c.MemReq),
 	}
+	if c.DiskReq > 0 {
+		res = append(res, util.NewScalarResource("disk", c.DiskReq))
+	}
+	for _, name := range sortedResourceNames(c.Resources) {
+		if c.Resources[name] > 0 {
+			res = append(res, util.NewScalarResource(name, c.Resources[name]))
+		}
+	}
+	if len(c.AllocatedPorts) > 0 {
+		res = append(res, util.NewRangesResource(RESOURCE_PORTS, newValueRanges(c.AllocatedPorts)))
+	}
+	return res
 }
 
 func (c *Command) StartPailers() {
-	c.StdoutPailer = c.createAndStartPailer("cmd.stdout", os.Stdout)
-	c.StderrPailer = c.createAndStartPailer("cmd.stderr", os.Stderr)
+	if err := c.fetchSandbox(); err != nil {
+		log.Errorf("Unable to start pailers for task %s: %s\n", c.Id, err)
+		return
+	}
+	stdout, stderr, err := output.Writers(c)
+	if err != nil {
+		log.Errorf("Unable to start pailers for task %s: %s\n", c.Id, err)
+		return
+	}
+	c.StdoutPailer = c.createAndStartPailer("cmd.stdout", stdout, c.stdoutOffset)
+	c.StderrPailer = c.createAndStartPailer("cmd.stderr", stderr, c.stderrOffset)
+}
+
+// returns how much of stdout and stderr was already streamed
+func (c *Command) OutputOffsets() (int, int) {
+	stdout, stderr := c.stdoutOffset, c.stderrOffset
+	if p := c.StdoutPailer; p != nil {
+		stdout = p.GetOffset()
+	}
+	if p := c.StderrPailer; p != nil {
+		stderr = p.GetOffset()
+	}
+	return stdout, stderr
+}
+
+// continue streaming stdout and stderr at the given offsets
+func (c *Command) SetOutputOffsets(stdout, stderr int) {
+	c.stdoutOffset = stdout
+	c.stderrOffset = stderr
 }
 
 func (c *Command) StopPailers() {
 	if c.StdoutPailer != nil {
 		c.StdoutPailer.Stop()
-		c.StdoutPailer = nil
 	}
 	if c.StderrPailer != nil {
 		c.StderrPailer.Stop()
@@ -79,10 +205,75 @@ func (c *Command) WaitForPailers() {
 	}
 }
 
+// calls kill once the command runs longer than its timeout
+func (c *Command) StartTimer(kill func()) {
+	if c.Timeout <= 0 {
+		return
+	}
+	c.timer = time.AfterFunc(c.Timeout, func() {
+		atomic.StoreInt32(&c.timedOut, 1)
+		kill()
+	})
+}
+
+func (c *Command) StopTimer() {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+}
+
+// checks if the command was killed because of its timeout
+func (c *Command) IsTimedOut() bool {
+	return atomic.LoadInt32(&c.timedOut) == 1
+}
+
+// reads the exit code recorded by the command's wrapper from the sandbox
+func (c *Command) FetchExitCode() (int, error) {
+	if err := c.fetchSandbox(); err != nil {
+		return 0, err
+	}
+	data, err := ReadSandboxFile(c.SlaveUrl, c.Directory, "cmd.exitcode")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(data))
+}
+
 // private
 
-func (c *Command) createAndStartPailer(file string, w StringWriter) *Pailer {
-	p, err := NewPailer(w, master, c, file)
+// the command's environment with the allocated ports as $PORT0..N
+func (c *Command) environment() map[string]string {
+	if len(c.AllocatedPorts) == 0 {
+		return c.Env
+	}
+	env := map[string]string{}
+	for k, v := range c.Env {
+		env[k] = v
+	}
+	for i, p := range c.AllocatedPorts {
+		env[fmt.Sprintf("PORT%d", i)] = strconv.FormatUint(p, 10)
+	}
+	return env
+}
+
+// looks up slave url and sandbox directory once
+func (c *Command) fetchSandbox() error {
+	if c.SlaveUrl != "" {
+		return nil
+	}
+	leader := leaderDetector.Leader()
+	su, d, err := FetchSlaveDirInfo(&leader, c)
+	if err != nil {
+		return err
+	}
+	c.SlaveUrl = su
+	c.Directory = d
+	return nil
+}
+
+func (c *Command) createAndStartPailer(file string, w StringWriter, offset int) *Pailer {
+	p, err := NewPailerAt(w, c.SlaveUrl, c.Directory, file, offset)
 	if err != nil {
 		log.Errorf("Unable to start pailer for task %s: %s\n", c.Id, err)
 		return nil
@@ -1,20 +1,54 @@
 package main
 
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/golang/glog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+const (
+	EXIT_CODE_MODE_MAX           = "max"
+	EXIT_CODE_MODE_FIRST_FAILURE = "first-failure"
+	EXIT_CODE_MODE_COUNT         = "count"
+
+	// exit code for failed commands without recorded exit code
+	EXIT_CODE_FAILURE = 1
+	// exit code for timed out commands, like timeout(1)
+	EXIT_CODE_TIMEOUT = 124
+	EXIT_CODE_MAX     = 255
+)
+
 type CommandHandler struct {
+	// fetches artifacts of finished commands if set
+	Artifacts     *ArtifactFetcher
 	commands      []*Command
+	failed        []*Command
 	tasksLaunched int
 	tasksEnded    int
 	tasksFailed   int
 	totalTasks    int
+	fetching      sync.WaitGroup
+	// exit codes fetched in the background, applied by FinishAllCommands
+	exitCodes map[*Command]int
+	mutex     chan bool
+	// input lines which could not be queued, counted from the input's goroutine
+	invalid int32
 }
 
 func NewCommandHandler() *CommandHandler {
 	return &CommandHandler{
 		commands:      []*Command{},
+		failed:        []*Command{},
 		tasksLaunched: 0,
 		tasksEnded:    0,
 		tasksFailed:   0,
 		totalTasks:    0,
+		exitCodes:     map[*Command]int{},
+		mutex:         make(chan bool, 1),
 	}
 }
 
@@ -24,32 +58,176 @@ func (ch *CommandHandler) CommandLaunched(c *Command) {
 }
 
 func (ch *CommandHandler) CommandRunning(c *Command) {
+	output.Record(c)
 	c.StartPailers()
 }
 
 func (ch *CommandHandler) CommandEnded(c *Command) {
 	ch.tasksEnded++
+	c.StopTimer()
+	if c.restored && c.StdoutPailer == nil && c.StderrPailer == nil {
+		// the task ended while NONE was down, read the output written since the last checkpoint
+		c.StartPailers()
+	}
 	c.StopPailers()
 }
 
 func (ch *CommandHandler) CommandFinished(c *Command) {
-
+	output.Record(c)
+	if ch.Artifacts != nil {
+		ch.fetchArtifacts(c)
+	}
 }
 
 func (ch *CommandHandler) CommandFailed(c *Command) {
 	ch.tasksFailed++
+	ch.failed = append(ch.failed, c)
+	c.ExitCode = EXIT_CODE_FAILURE
+	if c.Status.GetState() == mesos.TaskState_TASK_FAILED {
+		ch.fetchExitCode(c)
+	}
+	output.Record(c)
+}
+
+// the command was killed after exceeding its timeout
+func (ch *CommandHandler) CommandTimedOut(c *Command) {
+	ch.tasksFailed++
+	ch.failed = append(ch.failed, c)
+	c.ExitCode = EXIT_CODE_TIMEOUT
+	output.Record(c)
+	log.Errorf("Task %s timed out after %s\n", c.Id, c.Timeout)
+	fmt.Fprintf(os.Stderr, "NONE: task %s timed out after %s\n", c.Id, c.Timeout)
+}
+
+// the ended command c is launched again as command r
+func (ch *CommandHandler) CommandRetried(c, r *Command, maxRetries int) {
+	output.Record(c)
+	fmt.Fprintf(os.Stderr, "NONE: task %s ended with %s, retrying as task %s (attempt %d of %d)\n",
+		c.Id, c.Status.GetState().String(), r.Id, r.Attempt+1, maxRetries+1)
+}
+
+// a line of input could not be turned into a command, it fails the run
+func (ch *CommandHandler) CommandInvalid(line string, err error) {
+	atomic.AddInt32(&ch.invalid, 1)
+	log.Errorf("Skipping invalid command %s: %s\n", line, err)
+	fmt.Fprintf(os.Stderr, "NONE: skipping invalid command %s: %s\n", line, err)
+}
+
+// registers a launched command of a resumed run
+func (ch *CommandHandler) CommandRestored(c *Command) {
+	if !c.HasEnded() {
+		c.restored = true
+		ch.CommandLaunched(c)
+	} else if c.ExitCode != 0 {
+		ch.tasksFailed++
+		ch.failed = append(ch.failed, c)
+	}
 }
 
 func (ch *CommandHandler) FinishAllCommands() {
 	for _, c := range ch.commands {
 		c.WaitForPailers()
 	}
+	ch.fetching.Wait()
+
+	ch.mutex <- true
+	defer func() { <-ch.mutex }()
+	for c, code := range ch.exitCodes {
+		c.ExitCode = code
+		output.Record(c)
+	}
+	ch.exitCodes = map[*Command]int{}
+}
+
+// returns all launched commands which did not end yet
+func (ch *CommandHandler) ActiveCommands() []*Command {
+	active := []*Command{}
+	for _, c := range ch.commands {
+		if !c.HasEnded() {
+			active = append(active, c)
+		}
+	}
+	return active
 }
 
 func (ch *CommandHandler) HasFailures() bool {
-	return ch.tasksFailed > 0
+	return ch.tasksFailed > 0 || atomic.LoadInt32(&ch.invalid) > 0
+}
+
+// aggregates exit codes of all failed commands
+// invalid commands count as failures with EXIT_CODE_FAILURE
+func (ch *CommandHandler) ExitCode(mode string) int {
+	code := 0
+	invalid := int(atomic.LoadInt32(&ch.invalid))
+	switch mode {
+	case EXIT_CODE_MODE_MAX:
+		for _, c := range ch.failed {
+			if c.ExitCode > code {
+				code = c.ExitCode
+			}
+		}
+		if invalid > 0 && code < EXIT_CODE_FAILURE {
+			code = EXIT_CODE_FAILURE
+		}
+	case EXIT_CODE_MODE_FIRST_FAILURE:
+		if len(ch.failed) > 0 {
+			code = ch.failed[0].ExitCode
+		} else if invalid > 0 {
+			code = EXIT_CODE_FAILURE
+		}
+	case EXIT_CODE_MODE_COUNT:
+		code = len(ch.failed) + invalid
+	}
+	if code > EXIT_CODE_MAX {
+		return EXIT_CODE_MAX
+	}
+	return code
+}
+
+func IsValidExitCodeMode(mode string) bool {
+	return mode == EXIT_CODE_MODE_MAX || mode == EXIT_CODE_MODE_FIRST_FAILURE || mode == EXIT_CODE_MODE_COUNT
 }
 
 func (ch *CommandHandler) HasRunningTasks() bool {
 	return ch.tasksLaunched > ch.tasksEnded
 }
+
+// private
+
+// fetches the exit code of the failed command in the background
+// the master and slave may be slow, they must not block the scheduler
+func (ch *CommandHandler) fetchExitCode(c *Command) {
+	// a copy, finding the sandbox sets its url and directory
+	sandbox := &Command{Id: c.Id, FrameworkId: c.FrameworkId, SlaveId: c.SlaveId, SlaveUrl: c.SlaveUrl, Directory: c.Directory}
+	ch.fetching.Add(1)
+	go func() {
+		defer ch.fetching.Done()
+		code, err := sandbox.FetchExitCode()
+		if err != nil {
+			log.Errorf("Unable to fetch exit code of task %s: %s\n", sandbox.Id, err)
+			return
+		}
+		if code != 0 {
+			ch.mutex <- true
+			ch.exitCodes[c] = code
+			<-ch.mutex
+		}
+	}()
+}
+
+// downloads the command's artifacts in the background
+func (ch *CommandHandler) fetchArtifacts(c *Command) {
+	if err := c.fetchSandbox(); err != nil {
+		log.Errorf("Unable to fetch artifacts of task %s: %s\n", c.Id, err)
+		return
+	}
+	slaveUrl, dir, id := c.SlaveUrl, c.Directory, c.Id
+	ch.fetching.Add(1)
+	go func() {
+		defer ch.fetching.Done()
+		if _, err := ch.Artifacts.Fetch(slaveUrl, dir, id); err != nil {
+			log.Errorf("Unable to fetch artifacts of task %s: %s\n", id, err)
+			fmt.Fprintf(os.Stderr, "NONE: unable to fetch artifacts of task %s: %s\n", id, err)
+		}
+	}()
+}
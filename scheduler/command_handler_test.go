@@ -1,8 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,3 +58,134 @@ func TestHasRunningTasks(t *testing.T) {
 	ch.CommandEnded(c)
 	assert.False(t, ch.HasRunningTasks())
 }
+
+func TestActiveCommands(t *testing.T) {
+	ch := NewCommandHandler()
+	assert.Equal(t, 0, len(ch.ActiveCommands()))
+
+	c0 := &Command{}
+	c1 := &Command{}
+	ch.CommandLaunched(c0)
+	ch.CommandLaunched(c1)
+	assert.Equal(t, 2, len(ch.ActiveCommands()))
+
+	c0.Status = util.NewTaskStatus(util.NewTaskID("0"), mesos.TaskState_TASK_FINISHED)
+	assert.Equal(t, []*Command{c1}, ch.ActiveCommands())
+}
+
+func newEndedCommand(state mesos.TaskState, exitCode int) *Command {
+	return &Command{
+		Status:   util.NewTaskStatus(util.NewTaskID("0"), state),
+		ExitCode: exitCode,
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	ch := NewCommandHandler()
+	for _, mode := range []string{EXIT_CODE_MODE_MAX, EXIT_CODE_MODE_FIRST_FAILURE, EXIT_CODE_MODE_COUNT} {
+		assert.Equal(t, 0, ch.ExitCode(mode))
+	}
+
+	ch.failed = []*Command{
+		newEndedCommand(mesos.TaskState_TASK_FAILED, 3),
+		newEndedCommand(mesos.TaskState_TASK_FAILED, 42),
+		newEndedCommand(mesos.TaskState_TASK_LOST, 1),
+	}
+
+	assert.Equal(t, 42, ch.ExitCode(EXIT_CODE_MODE_MAX))
+	assert.Equal(t, 3, ch.ExitCode(EXIT_CODE_MODE_FIRST_FAILURE))
+	assert.Equal(t, 3, ch.ExitCode(EXIT_CODE_MODE_COUNT))
+}
+
+func TestExitCodeWithInvalidCommands(t *testing.T) {
+	ch := NewCommandHandler()
+	ch.CommandInvalid("{", errors.New("unexpected end of JSON input"))
+	assert.True(t, ch.HasFailures())
+	assert.Equal(t, EXIT_CODE_FAILURE, ch.ExitCode(EXIT_CODE_MODE_MAX))
+	assert.Equal(t, EXIT_CODE_FAILURE, ch.ExitCode(EXIT_CODE_MODE_FIRST_FAILURE))
+	assert.Equal(t, 1, ch.ExitCode(EXIT_CODE_MODE_COUNT))
+
+	ch.failed = []*Command{newEndedCommand(mesos.TaskState_TASK_FAILED, 42)}
+	assert.Equal(t, 42, ch.ExitCode(EXIT_CODE_MODE_MAX))
+	assert.Equal(t, 42, ch.ExitCode(EXIT_CODE_MODE_FIRST_FAILURE))
+	assert.Equal(t, 2, ch.ExitCode(EXIT_CODE_MODE_COUNT))
+}
+
+func TestExitCodeCountIsCapped(t *testing.T) {
+	ch := NewCommandHandler()
+	for i := 0; i < 300; i++ {
+		ch.failed = append(ch.failed, newEndedCommand(mesos.TaskState_TASK_LOST, 1))
+	}
+
+	assert.Equal(t, EXIT_CODE_MAX, ch.ExitCode(EXIT_CODE_MODE_COUNT))
+}
+
+func TestCommandFailedFetchesExitCode(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"offset": 0, "data": "42\n"}`)
+	}))
+	defer ts.Close()
+
+	ch := NewCommandHandler()
+	c := newEndedCommand(mesos.TaskState_TASK_FAILED, 0)
+	c.SlaveUrl = ts.URL
+	c.Directory = "/sandbox"
+	ch.CommandLaunched(c)
+	ch.CommandEnded(c)
+	ch.CommandFailed(c)
+	assert.Equal(t, EXIT_CODE_FAILURE, c.ExitCode, "exit code should be fetched in the background")
+
+	ch.FinishAllCommands()
+	assert.Equal(t, 42, c.ExitCode)
+	assert.Equal(t, 42, ch.ExitCode(EXIT_CODE_MODE_MAX))
+}
+
+func TestCommandFailedWithoutExitCode(t *testing.T) {
+	ch := NewCommandHandler()
+	c := newEndedCommand(mesos.TaskState_TASK_LOST, 0)
+	ch.CommandLaunched(c)
+	ch.CommandEnded(c)
+	ch.CommandFailed(c)
+
+	assert.Equal(t, EXIT_CODE_FAILURE, c.ExitCode)
+}
+
+func TestIsValidExitCodeMode(t *testing.T) {
+	assert.True(t, IsValidExitCodeMode("max"))
+	assert.True(t, IsValidExitCodeMode("first-failure"))
+	assert.True(t, IsValidExitCodeMode("count"))
+	assert.False(t, IsValidExitCodeMode("foo"))
+}
+
+func TestCommandTimedOut(t *testing.T) {
+	ch := NewCommandHandler()
+	c := newEndedCommand(mesos.TaskState_TASK_KILLED, 0)
+	ch.CommandLaunched(c)
+	ch.CommandEnded(c)
+	ch.CommandTimedOut(c)
+
+	assert.True(t, ch.HasFailures())
+	assert.Equal(t, EXIT_CODE_TIMEOUT, ch.ExitCode(EXIT_CODE_MODE_MAX))
+}
+
+func TestCommandEndedReadsOutputOfRestoredCommand(t *testing.T) {
+	ts := newFileServer("hello world\n")
+	defer ts.Close()
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	output = NewOutput(stdout, stderr, OUTPUT_MODE_STREAM, false, false, false)
+	defer func() { output = NewOutput(os.Stdout, os.Stderr, OUTPUT_MODE_STREAM, false, false, false) }()
+
+	ch := NewCommandHandler()
+	c := &Command{Id: "1", SlaveId: "slave", SlaveUrl: ts.URL, Directory: "/sandbox"}
+	c.SetOutputOffsets(6, 12)
+	ch.CommandRestored(c)
+
+	// reconciliation reports the task finished while NONE was down
+	c.Status = util.NewTaskStatus(util.NewTaskID(c.Id), mesos.TaskState_TASK_FINISHED)
+	ch.CommandEnded(c)
+	ch.CommandFinished(c)
+	ch.FinishAllCommands()
+
+	assert.Equal(t, "world\n", stdout.String())
+	assert.Equal(t, "", stderr.String())
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"strconv"
+	"time"
 )
 
 const (
@@ -11,62 +12,151 @@ const (
 type CommandQueuer interface {
 	Next() *Command
 	GetCommand() *Command
+	Pending(int) []*Command
+	Take(*Command)
 	GetCommandById(string) *Command
+	Requeue(*Command, time.Duration)
+	Restore(*Command)
+	Commands() []*Command
+	Stop()
 	Closed() bool
 }
 
 type CommandQueue struct {
-	c        chan *Command
-	next     *Command
-	commands map[string]*Command
-	nextId   int
-	mutexId  chan bool
-	closed   bool
+	c              chan *Command
+	pending        []*Command
+	commands       map[string]*Command
+	retries        []*Command
+	pendingRetries int
+	nextId         int
+	mutexId        chan bool
+	mutexRetries   chan bool
+	closed         bool
+	done           chan bool
 }
 
 func NewCommandQueue() *CommandQueue {
 	return &CommandQueue{
-		c:        make(chan *Command, COMMAND_QUEUE_SIZE),
-		commands: make(map[string]*Command, COMMAND_QUEUE_SIZE),
-		next:     nil,
-		nextId:   0,
-		mutexId:  make(chan bool, 1),
-		closed:   false,
+		c:            make(chan *Command, COMMAND_QUEUE_SIZE),
+		commands:     make(map[string]*Command, COMMAND_QUEUE_SIZE),
+		nextId:       0,
+		mutexId:      make(chan bool, 1),
+		mutexRetries: make(chan bool, 1),
+		closed:       false,
+		done:         make(chan bool),
 	}
 }
 
-// fetches the next command from queue, may return nil if none is available
+// drops the current command and fetches the next one, may return nil if none is available
 func (cq *CommandQueue) Next() *Command {
-	select {
-	case cq.next = <-cq.c:
-		if cq.next == nil {
-			// channel was closed, stop listening for new commands
-			cq.closed = true
-		}
-	default:
-		cq.next = nil
+	if len(cq.pending) > 0 {
+		cq.pending = cq.pending[1:]
+	}
+	if cq.isStopped() {
+		cq.pending = nil
+		return nil
 	}
-	return cq.next
+	return cq.GetCommand()
 }
 
 // returns the current command, may return nil if none is available
 func (cq *CommandQueue) GetCommand() *Command {
-	if cq.next == nil {
-		return cq.Next()
+	if len(cq.pending) == 0 && !cq.fetch() {
+		return nil
+	}
+	return cq.pending[0]
+}
+
+// returns up to n commands in the order they are going to be launched, starting with the current one
+func (cq *CommandQueue) Pending(n int) []*Command {
+	if cq.isStopped() {
+		cq.pending = nil
+		return nil
+	}
+	for len(cq.pending) < n && cq.fetch() {
+	}
+	if len(cq.pending) < n {
+		n = len(cq.pending)
+	}
+	return cq.pending[:n:n]
+}
+
+// removes a pending command, which is launched ahead of the current one
+func (cq *CommandQueue) Take(command *Command) {
+	for i, c := range cq.pending {
+		if c == command {
+			cq.pending = append(cq.pending[:i:i], cq.pending[i+1:]...)
+			return
+		}
 	}
-	return cq.next
 }
 
 // fetch a command by id
 func (cq *CommandQueue) GetCommandById(id string) *Command {
+	cq.mutexId <- true
+	defer func() { <-cq.mutexId }()
 	return cq.commands[id]
 }
 
-// pushes a command into the queue
+// pushes a command into the queue, the command is dropped if the queue was stopped
 func (cq *CommandQueue) Enqueue(command *Command) {
-	command.Id = cq.getNextId()
+	if cq.isStopped() {
+		return
+	}
+	cq.register(command)
+	select {
+	case cq.c <- command:
+	case <-cq.done:
+	}
+}
+
+// pushes a command into the queue again after delay
+// the command gets a new id right away
+func (cq *CommandQueue) Requeue(command *Command, delay time.Duration) {
+	if cq.isStopped() {
+		return
+	}
+	cq.register(command)
+	cq.mutexRetries <- true
+	cq.pendingRetries++
+	<-cq.mutexRetries
+
+	time.AfterFunc(delay, func() {
+		cq.mutexRetries <- true
+		cq.pendingRetries--
+		cq.retries = append(cq.retries, command)
+		<-cq.mutexRetries
+	})
+}
+
+// registers a command of a resumed run under its previous id
+// commands which were not launched yet are queued again
+func (cq *CommandQueue) Restore(command *Command) {
+	cq.mutexId <- true
 	cq.commands[command.Id] = command
-	cq.c <- command
+	if id, err := strconv.Atoi(command.Id); err == nil && id > cq.nextId {
+		cq.nextId = id
+	}
+	<-cq.mutexId
+
+	if command.SlaveId == "" && command.Status == nil {
+		cq.mutexRetries <- true
+		cq.retries = append(cq.retries, command)
+		<-cq.mutexRetries
+	}
+}
+
+// returns all registered commands ordered by id
+func (cq *CommandQueue) Commands() []*Command {
+	cq.mutexId <- true
+	defer func() { <-cq.mutexId }()
+	commands := []*Command{}
+	for id := 1; id <= cq.nextId; id++ {
+		if c, ok := cq.commands[strconv.Itoa(id)]; ok {
+			commands = append(commands, c)
+		}
+	}
+	return commands
 }
 
 // closes the queue
@@ -74,16 +164,74 @@ func (cq *CommandQueue) Close() {
 	close(cq.c)
 }
 
-// checks if the queue is closed AND empty
+// stops handing out commands, queued and future commands are dropped
+func (cq *CommandQueue) Stop() {
+	if !cq.isStopped() {
+		close(cq.done)
+	}
+}
+
+// checks if the queue is closed AND empty, or stopped
 func (cq *CommandQueue) Closed() bool {
-	return cq.closed
+	if cq.isStopped() {
+		return true
+	}
+	cq.mutexRetries <- true
+	defer func() { <-cq.mutexRetries }()
+	// pending commands are not launched yet, they are taken once launched
+	return cq.closed && len(cq.pending) == 0 && cq.pendingRetries == 0 && len(cq.retries) == 0
+}
+
+func (cq *CommandQueue) isStopped() bool {
+	select {
+	case <-cq.done:
+		return true
+	default:
+		return false
+	}
 }
 
-// create a unique task id
-func (cq *CommandQueue) getNextId() string {
+// appends the next command to the pending ones, returns false if none is available
+// commands to retry are preferred over new commands
+func (cq *CommandQueue) fetch() bool {
+	if cq.isStopped() {
+		return false
+	}
+	c := cq.nextRetry()
+	if c == nil && !cq.closed {
+		select {
+		case c = <-cq.c:
+			if c == nil {
+				// channel was closed, stop listening for new commands
+				cq.closed = true
+			}
+		default:
+		}
+	}
+	if c == nil {
+		return false
+	}
+	cq.pending = append(cq.pending, c)
+	return true
+}
+
+// pops the next command to retry, may return nil
+func (cq *CommandQueue) nextRetry() *Command {
+	cq.mutexRetries <- true
+	defer func() { <-cq.mutexRetries }()
+	if len(cq.retries) == 0 {
+		return nil
+	}
+	c := cq.retries[0]
+	cq.retries = cq.retries[1:]
+	return c
+}
+
+// assigns a unique id and registers the command
+func (cq *CommandQueue) register(command *Command) {
 	cq.mutexId <- true
 	cq.nextId++
-	id := strconv.Itoa(cq.nextId)
+	command.Id = strconv.Itoa(cq.nextId)
+	cq.commands[command.Id] = command
 	<-cq.mutexId
-	return id
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -45,3 +46,135 @@ func TestClosed(t *testing.T) {
 	assert.Nil(t, cq.Next())
 	assert.True(t, cq.Closed())
 }
+
+func TestRequeue(t *testing.T) {
+	cq := NewCommandQueue()
+	c0 := &Command{}
+	cq.Enqueue(c0)
+	cq.Close()
+	assert.Equal(t, c0, cq.Next())
+
+	c1 := &Command{}
+	cq.Requeue(c1, 10*time.Millisecond)
+	assert.NotEmpty(t, c1.Id, "command should have got an id")
+	assert.NotEqual(t, c0.Id, c1.Id)
+	assert.Equal(t, c1, cq.GetCommandById(c1.Id))
+
+	assert.Nil(t, cq.Next())
+	assert.False(t, cq.Closed(), "queue should wait for retry")
+
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, cq.Closed())
+	assert.Equal(t, c1, cq.Next())
+	assert.False(t, cq.Closed(), "retry was not launched yet")
+	cq.Take(c1)
+	assert.True(t, cq.Closed())
+}
+
+func TestClosedWaitsForCurrentRetry(t *testing.T) {
+	cq := NewCommandQueue()
+	cq.Close()
+	assert.Nil(t, cq.GetCommand())
+	assert.True(t, cq.Closed())
+
+	c := &Command{}
+	cq.Requeue(c, 0)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, c, cq.GetCommand())
+	assert.False(t, cq.Closed(), "current retry was not launched yet")
+	assert.Nil(t, cq.Next())
+	assert.True(t, cq.Closed())
+}
+
+func TestRequeueIsPreferred(t *testing.T) {
+	cq := NewCommandQueue()
+	c0 := &Command{}
+	cq.Enqueue(c0)
+
+	c1 := &Command{}
+	cq.Requeue(c1, 0)
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Equal(t, c1, cq.Next())
+	assert.Equal(t, c0, cq.Next())
+}
+
+func TestStop(t *testing.T) {
+	cq := NewCommandQueue()
+	c := &Command{}
+	cq.Enqueue(c)
+	assert.False(t, cq.Closed())
+
+	cq.Stop()
+	assert.True(t, cq.Closed())
+	assert.Nil(t, cq.Next())
+
+	cq.Enqueue(&Command{})
+	cq.Requeue(&Command{}, 0)
+	assert.Nil(t, cq.GetCommand())
+
+	cq.Stop()
+	assert.True(t, cq.Closed())
+}
+
+func TestStopUnblocksEnqueue(t *testing.T) {
+	cq := NewCommandQueue()
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < COMMAND_QUEUE_SIZE+1; i++ {
+			cq.Enqueue(&Command{})
+		}
+		done <- true
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cq.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Enqueue should not block after Stop")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	cq := NewCommandQueue()
+	pending := &Command{Id: "3"}
+	running := &Command{Id: "5", SlaveId: "slave-1"}
+	cq.Restore(pending)
+	cq.Restore(running)
+	cq.Close()
+
+	assert.Equal(t, running, cq.GetCommandById("5"))
+	assert.Equal(t, []*Command{pending, running}, cq.Commands())
+	assert.Equal(t, pending, cq.Next(), "pending command should be queued again")
+	assert.Nil(t, cq.Next())
+	assert.True(t, cq.Closed())
+
+	c := &Command{}
+	cq.Requeue(c, time.Hour)
+	assert.Equal(t, "6", c.Id, "ids should continue after restored commands")
+}
+
+func TestPendingAndTake(t *testing.T) {
+	cq := NewCommandQueue()
+	c0 := &Command{}
+	c1 := &Command{}
+	c2 := &Command{}
+	cq.Enqueue(c0)
+	cq.Enqueue(c1)
+	cq.Enqueue(c2)
+	cq.Close()
+
+	assert.Equal(t, []*Command{c0, c1}, cq.Pending(2))
+	assert.Equal(t, c0, cq.GetCommand())
+
+	cq.Take(c1)
+	assert.Equal(t, []*Command{c0, c2}, cq.Pending(5))
+	assert.False(t, cq.Closed(), "c2 is still queued")
+
+	cq.Take(c0)
+	assert.Equal(t, c2, cq.GetCommand())
+	assert.Nil(t, cq.Next())
+	assert.True(t, cq.Closed())
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+const (
+	INPUT_FORMAT_PLAIN = "plain"
+	INPUT_FORMAT_JSON  = "json"
+)
+
+// a single command read from stdin in JSON Lines format
+// unset fields fall back to the command line flags
+type CommandSpec struct {
+	Cmd         string             `json:"cmd"`
+	Name        string             `json:"name"`
+	Cpus        *float64           `json:"cpus"`
+	Mem         *float64           `json:"mem"`
+	Disk        *float64           `json:"disk"`
+	Ports       *int               `json:"ports"`
+	Resources   map[string]float64 `json:"resources"`
+	Image       string             `json:"image"`
+	Constraints string             `json:"constraints"`
+	Env         map[string]string  `json:"env"`
+	Timeout     string             `json:"timeout"`
+}
+
+func ParseCommandSpec(line string) (*CommandSpec, error) {
+	var s CommandSpec
+	if err := json.Unmarshal([]byte(line), &s); err != nil {
+		return nil, err
+	}
+	if s.Cmd == "" {
+		return nil, fmt.Errorf("Missing cmd")
+	}
+	return &s, nil
+}
+
+// apply spec to command, overwriting its defaults
+func (s *CommandSpec) Apply(c *Command) error {
+	c.Cmd = s.Cmd
+	c.Name = s.Name
+	if s.Cpus != nil {
+		if *s.Cpus < 0 {
+			return fmt.Errorf("Invalid cpus %v", *s.Cpus)
+		}
+		c.CpuReq = *s.Cpus
+	}
+	if s.Mem != nil {
+		if *s.Mem < 0 {
+			return fmt.Errorf("Invalid mem %v", *s.Mem)
+		}
+		c.MemReq = *s.Mem
+	}
+	if s.Disk != nil {
+		if *s.Disk < 0 {
+			return fmt.Errorf("Invalid disk %v", *s.Disk)
+		}
+		c.DiskReq = *s.Disk
+	}
+	if s.Ports != nil {
+		if *s.Ports < 0 {
+			return fmt.Errorf("Invalid number of ports %d", *s.Ports)
+		}
+		c.Ports = *s.Ports
+	}
+	if len(s.Resources) > 0 {
+		// keep the defaults of other resources
+		res := map[string]float64{}
+		for name, v := range c.Resources {
+			res[name] = v
+		}
+		for name, v := range s.Resources {
+			if v < 0 {
+				return fmt.Errorf("Invalid value of resource %s", name)
+			}
+			res[name] = v
+		}
+		c.Resources = res
+	}
+	if s.Image != "" {
+		c.ContainerInfo = newDockerContainerInfo(s.Image)
+	}
+	if s.Constraints != "" {
+		cs, err := ParseConstraints(&s.Constraints)
+		if err != nil {
+			return err
+		}
+		c.Constraints = cs
+	}
+	if s.Timeout != "" {
+		t, err := time.ParseDuration(s.Timeout)
+		if err != nil {
+			return err
+		}
+		c.Timeout = t
+	}
+	c.Env = s.Env
+	return nil
+}
+
+func newDockerContainerInfo(image string) *mesos.ContainerInfo {
+	return &mesos.ContainerInfo{
+		Type: mesos.ContainerInfo_DOCKER.Enum(),
+		Docker: &mesos.ContainerInfo_DockerInfo{
+			Image: proto.String(image),
+		},
+	}
+}
+
+func newEnvironment(env map[string]string) *mesos.Environment {
+	if len(env) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(env))
+	for n := range env {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	vars := make([]*mesos.Environment_Variable, len(names))
+	for i, n := range names {
+		vars[i] = &mesos.Environment_Variable{
+			Name:  proto.String(n),
+			Value: proto.String(env[n]),
+		}
+	}
+	return &mesos.Environment{Variables: vars}
+}
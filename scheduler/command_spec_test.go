@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommandSpec(t *testing.T) {
+	s, err := ParseCommandSpec(`{"cmd": "make", "name": "compile", "cpus": 4, "mem": 16384, "disk": 2048, "image": "golang", "constraints": "rack:EQUALS:a", "env": {"GOOS": "linux"}}`)
+	assert.Nil(t, err)
+	assert.NotNil(t, s)
+
+	assert.Equal(t, "make", s.Cmd)
+	assert.Equal(t, "compile", s.Name)
+	assert.Equal(t, 4.0, *s.Cpus)
+	assert.Equal(t, 16384.0, *s.Mem)
+	assert.Equal(t, 2048.0, *s.Disk)
+	assert.Equal(t, "golang", s.Image)
+	assert.Equal(t, "rack:EQUALS:a", s.Constraints)
+	assert.Equal(t, map[string]string{"GOOS": "linux"}, s.Env)
+}
+
+func TestApplyCommandSpecResources(t *testing.T) {
+	c := &Command{Resources: map[string]float64{"licenses": 1}}
+	s, err := ParseCommandSpec(`{"cmd": "serve", "ports": 2, "resources": {"gpus": 1}}`)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Apply(c))
+
+	assert.Equal(t, 2, c.Ports)
+	assert.Equal(t, map[string]float64{"licenses": 1, "gpus": 1}, c.Resources)
+}
+
+func TestApplyCommandSpecNegativeResources(t *testing.T) {
+	s, err := ParseCommandSpec(`{"cmd": "serve", "ports": -1}`)
+	assert.Nil(t, err)
+	assert.NotNil(t, s.Apply(&Command{}))
+
+	s, err = ParseCommandSpec(`{"cmd": "serve", "resources": {"gpus": -1}}`)
+	assert.Nil(t, err)
+	assert.NotNil(t, s.Apply(&Command{}))
+
+	for _, spec := range []string{`{"cmd": "serve", "cpus": -1}`, `{"cmd": "serve", "mem": -128}`, `{"cmd": "serve", "disk": -0.5}`} {
+		s, err = ParseCommandSpec(spec)
+		assert.Nil(t, err)
+		assert.NotNil(t, s.Apply(&Command{}), spec)
+	}
+
+	s, err = ParseCommandSpec(`{"cmd": "serve", "cpus": 0, "mem": 0, "disk": 0}`)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Apply(&Command{}))
+}
+
+func TestParseCommandSpecInvalid(t *testing.T) {
+	s, err := ParseCommandSpec(`{"cmd": "echo foo"`)
+	assert.NotNil(t, err)
+	assert.Nil(t, s)
+
+	s, err = ParseCommandSpec(`{"name": "foo"}`)
+	assert.NotNil(t, err, "cmd is mandatory")
+	assert.Nil(t, s)
+}
+
+func TestApplyCommandSpec(t *testing.T) {
+	c := &Command{
+		CpuReq:        1,
+		MemReq:        128,
+		ContainerInfo: newDockerContainerInfo("default"),
+	}
+
+	s, _ := ParseCommandSpec(`{"cmd": "make", "mem": 16384, "image": "golang", "constraints": "rack:EQUALS:a"}`)
+	assert.Nil(t, s.Apply(c))
+
+	assert.Equal(t, "make", c.Cmd)
+	assert.Equal(t, 1.0, c.CpuReq, "default should be kept")
+	assert.Equal(t, 16384.0, c.MemReq)
+	assert.Equal(t, "golang", c.ContainerInfo.GetDocker().GetImage())
+	assert.NotNil(t, c.Constraints)
+}
+
+func TestApplyCommandSpecKeepsDefaults(t *testing.T) {
+	ci := newDockerContainerInfo("default")
+	c := &Command{
+		CpuReq:        1,
+		MemReq:        128,
+		ContainerInfo: ci,
+	}
+
+	s, _ := ParseCommandSpec(`{"cmd": "echo foo"}`)
+	assert.Nil(t, s.Apply(c))
+
+	assert.Equal(t, 1.0, c.CpuReq)
+	assert.Equal(t, 128.0, c.MemReq)
+	assert.Equal(t, 0.0, c.DiskReq)
+	assert.Equal(t, ci, c.ContainerInfo)
+	assert.Nil(t, c.Constraints)
+}
+
+func TestApplyCommandSpecInvalidConstraints(t *testing.T) {
+	s, _ := ParseCommandSpec(`{"cmd": "echo foo", "constraints": "rack:FOO:a"}`)
+	assert.NotNil(t, s.Apply(&Command{}))
+}
+
+func TestApplyCommandSpecTimeout(t *testing.T) {
+	c := &Command{Timeout: time.Hour}
+	s, _ := ParseCommandSpec(`{"cmd": "make", "timeout": "10m"}`)
+	assert.Nil(t, s.Apply(c))
+	assert.Equal(t, 10*time.Minute, c.Timeout)
+
+	s, _ = ParseCommandSpec(`{"cmd": "make", "timeout": "ten minutes"}`)
+	assert.NotNil(t, s.Apply(c))
+}
@@ -2,21 +2,32 @@ package main
 
 import (
 	"testing"
+	"time"
 
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
-func TestMatchesResources(t *testing.T) {
-	c := &Command{
-		CpuReq: 1,
-		MemReq: 128,
-	}
+func TestMatchesConstraints(t *testing.T) {
+	o := &mesos.Offer{}
+	c := &Command{}
+	assert.True(t, c.MatchesConstraints(o, nil))
+
+	mc := new(MockConstraint)
+	mc.On("Match", o, mock.Anything).Return(false)
+	c.Constraints = mc
+	assert.False(t, c.MatchesConstraints(o, nil))
+	mc.AssertExpectations(t)
+}
+
+func TestGetName(t *testing.T) {
+	c := &Command{Id: "1"}
+	assert.Equal(t, "none-task-1", c.GetName())
 
-	assert.False(t, c.MatchesResources(0.1, 0.1))
-	assert.False(t, c.MatchesResources(1000, 0.1))
-	assert.False(t, c.MatchesResources(0.1, 1000))
-	assert.True(t, c.MatchesResources(1, 128))
-	assert.True(t, c.MatchesResources(2, 256))
+	c.Name = "compile"
+	assert.Equal(t, "compile", c.GetName())
 }
 
 func TestGetCommandInfo(t *testing.T) {
@@ -28,6 +39,23 @@ func TestGetCommandInfo(t *testing.T) {
 	assert.NotNil(t, ci)
 	assert.Equal(t, "sh", ci.GetValue())
 	assert.False(t, ci.GetShell())
+	assert.Nil(t, ci.GetEnvironment())
+	assert.Contains(t, ci.GetArguments()[2], "( foo ) > cmd.stdout 2> cmd.stderr")
+	assert.Contains(t, ci.GetArguments()[2], "> cmd.exitcode; exit $rc")
+}
+
+func TestGetCommandInfoWithEnv(t *testing.T) {
+	c := &Command{
+		Cmd: "foo",
+		Env: map[string]string{"FOO": "foo", "BAR": "bar"},
+	}
+
+	vars := c.GetCommandInfo().GetEnvironment().GetVariables()
+	assert.Equal(t, 2, len(vars))
+	assert.Equal(t, "BAR", vars[0].GetName())
+	assert.Equal(t, "bar", vars[0].GetValue())
+	assert.Equal(t, "FOO", vars[1].GetName())
+	assert.Equal(t, "foo", vars[1].GetValue())
 }
 
 func TestGetResources(t *testing.T) {
@@ -42,4 +70,105 @@ func TestGetResources(t *testing.T) {
 	assert.Equal(t, 2.0, res[0].GetScalar().GetValue())
 	assert.Equal(t, "mem", res[1].GetName())
 	assert.Equal(t, 256.0, res[1].GetScalar().GetValue())
+
+	c.DiskReq = 1024
+	res = c.GetResources()
+	assert.Equal(t, 3, len(res))
+	assert.Equal(t, "disk", res[2].GetName())
+	assert.Equal(t, 1024.0, res[2].GetScalar().GetValue())
+
+	c.Resources = map[string]float64{"licenses": 1}
+	c.AllocatedPorts = []uint64{31000, 31001}
+	res = c.GetResources()
+	assert.Equal(t, 5, len(res))
+	assert.Equal(t, "licenses", res[3].GetName())
+	assert.Equal(t, 1.0, res[3].GetScalar().GetValue())
+	assert.Equal(t, "ports", res[4].GetName())
+	assert.Equal(t, uint64(31000), res[4].GetRanges().GetRange()[0].GetBegin())
+	assert.Equal(t, uint64(31001), res[4].GetRanges().GetRange()[0].GetEnd())
+}
+
+func TestAllocatedPortsInEnvironment(t *testing.T) {
+	c := &Command{Cmd: "serve", Env: map[string]string{"FOO": "bar"}, AllocatedPorts: []uint64{31000, 31005}}
+	vars := c.GetCommandInfo().GetEnvironment().GetVariables()
+	assert.Equal(t, 3, len(vars))
+	assert.Equal(t, "FOO", vars[0].GetName())
+	assert.Equal(t, "PORT0", vars[1].GetName())
+	assert.Equal(t, "31000", vars[1].GetValue())
+	assert.Equal(t, "PORT1", vars[2].GetName())
+	assert.Equal(t, "31005", vars[2].GetValue())
+	assert.Equal(t, 1, len(c.Env), "command's env should not be changed")
+}
+
+func TestNewAttempt(t *testing.T) {
+	c := &Command{
+		Id:       "1",
+		SlaveId:  "slave",
+		Hostname: "host",
+		Cmd:      "foo",
+		CpuReq:   2,
+		Status:   util.NewTaskStatus(util.NewTaskID("1"), mesos.TaskState_TASK_LOST),
+	}
+
+	a := c.NewAttempt()
+	assert.Empty(t, a.Id)
+	assert.Empty(t, a.SlaveId)
+	assert.Empty(t, a.Hostname)
+	assert.Nil(t, a.Status)
+	assert.Equal(t, "foo", a.Cmd)
+	assert.Equal(t, 2.0, a.CpuReq)
+	assert.Equal(t, 1, a.Attempt)
+	assert.Equal(t, 2, a.NewAttempt().Attempt)
+	assert.Equal(t, "1", c.Id, "original command should not be modified")
+}
+
+func TestStartTimer(t *testing.T) {
+	c := &Command{Timeout: 10 * time.Millisecond}
+	killed := make(chan bool, 1)
+
+	c.StartTimer(func() { killed <- true })
+	assert.False(t, c.IsTimedOut())
+
+	select {
+	case <-killed:
+	case <-time.After(time.Second):
+		t.Fatal("command should have been killed")
+	}
+	assert.True(t, c.IsTimedOut())
+	assert.False(t, c.NewAttempt().IsTimedOut())
+}
+
+func TestStopTimer(t *testing.T) {
+	c := &Command{Timeout: 10 * time.Millisecond}
+	c.StartTimer(func() { t.Fatal("command should not have been killed") })
+	c.StopTimer()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, c.IsTimedOut())
+}
+
+func TestStartTimerWithoutTimeout(t *testing.T) {
+	c := &Command{}
+	c.StartTimer(func() { t.Fatal("command should not have been killed") })
+	assert.Nil(t, c.timer)
+}
+
+func TestWaitForPailersAfterStop(t *testing.T) {
+	ts := newFileServer("foo")
+	defer ts.Close()
+
+	stdout, stderr := &MockStringWriter{}, &MockStringWriter{}
+	c := &Command{}
+	c.StdoutPailer, _ = NewPailer(stdout, ts.URL, "/sandbox", "cmd.stdout")
+	c.StderrPailer, _ = NewPailer(stderr, ts.URL, "/sandbox", "cmd.stderr")
+	c.StdoutPailer.Start()
+	c.StderrPailer.Start()
+
+	c.StopPailers()
+	assert.NotNil(t, c.StdoutPailer, "stopped pailers should be waited for")
+	c.WaitForPailers()
+	assert.Equal(t, "foo", stdout.Data)
+	assert.Equal(t, "foo", stderr.Data)
+	assert.Nil(t, c.StdoutPailer)
+	assert.Nil(t, c.StderrPailer)
 }
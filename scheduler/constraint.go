@@ -2,48 +2,118 @@ package main
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 
 	mesos "github.com/mesos/mesos-go/mesosproto"
 )
 
 const (
-	CONSTRAINT_OPERATOR_EQUALS = "EQUALS"
+	CONSTRAINT_OPERATOR_EQUALS   = "EQUALS"
+	CONSTRAINT_OPERATOR_LIKE     = "LIKE"
+	CONSTRAINT_OPERATOR_UNLIKE   = "UNLIKE"
+	CONSTRAINT_OPERATOR_UNIQUE   = "UNIQUE"
+	CONSTRAINT_OPERATOR_GROUP_BY = "GROUP_BY"
+	CONSTRAINT_OPERATOR_MAX_PER  = "MAX_PER"
+	CONSTRAINT_OPERATOR_GT       = "GT"
+	CONSTRAINT_OPERATOR_LT       = "LT"
+	CONSTRAINT_OPERATOR_GE       = "GE"
+	CONSTRAINT_OPERATOR_LE       = "LE"
+
+	// pseudo attribute matching the offer's hostname
+	CONSTRAINT_ATTRIBUTE_HOSTNAME = "hostname"
 )
 
 // Constraints
 
 type Constraints []Constraint
 
+// parses a constraint expression, see constraint_parser.go for its syntax
 func ParseConstraints(params *string) (Constraints, error) {
-	if params == nil || len(*params) == 0 {
+	if params == nil || len(strings.TrimSpace(*params)) == 0 {
 		return Constraints{}, nil
 	}
-	constraints := strings.Split(*params, ";")
-	cs := make([]Constraint, len(constraints))
-	for i, p := range constraints {
-		c, err := ParseConstraint(&p)
-		if err != nil {
-			return nil, err
-		}
-		cs[i] = c
+	c, err := parseConstraintExpression(*params)
+	if err != nil {
+		return nil, err
+	}
+	if cs, ok := c.(Constraints); ok {
+		return cs, nil
 	}
-	return cs, nil
+	return Constraints{c}, nil
 }
 
-func (cs Constraints) Match(offer *mesos.Offer) bool {
+func (cs Constraints) Match(offer *mesos.Offer, placed []*Command) bool {
 	for _, c := range cs {
-		if !c.Match(offer) {
+		if !c.Match(offer, placed) {
 			return false
 		}
 	}
 	return true
 }
 
+func (cs Constraints) String() string {
+	return joinConstraints(cs, " & ")
+}
+
+// OrConstraints
+
+type OrConstraints []Constraint
+
+func (cs OrConstraints) Match(offer *mesos.Offer, placed []*Command) bool {
+	for _, c := range cs {
+		if c.Match(offer, placed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cs OrConstraints) String() string {
+	return joinConstraints(cs, " | ")
+}
+
+// NotConstraint
+
+type NotConstraint struct {
+	Constraint Constraint
+}
+
+func (c *NotConstraint) Match(offer *mesos.Offer, placed []*Command) bool {
+	return !c.Constraint.Match(offer, placed)
+}
+
+func (c *NotConstraint) String() string {
+	return "!" + formatNestedConstraint(c.Constraint)
+}
+
+func joinConstraints(cs []Constraint, sep string) string {
+	if len(cs) == 1 {
+		return fmt.Sprint(cs[0])
+	}
+	s := make([]string, len(cs))
+	for i, c := range cs {
+		s[i] = formatNestedConstraint(c)
+	}
+	return strings.Join(s, sep)
+}
+
+// wraps compound constraints in parentheses
+func formatNestedConstraint(c Constraint) string {
+	switch c.(type) {
+	case Constraints, OrConstraints:
+		return fmt.Sprintf("(%v)", c)
+	}
+	return fmt.Sprint(c)
+}
+
 // Constraint
 
+// A Constraint decides whether a command may be launched with an offer.
+// placed holds the commands which are already running on the cluster.
 type Constraint interface {
-	Match(offer *mesos.Offer) bool
+	Match(offer *mesos.Offer, placed []*Command) bool
 }
 
 func ParseConstraint(params *string) (Constraint, error) {
@@ -62,12 +132,111 @@ func ParseConstraint(params *string) (Constraint, error) {
 }
 
 func NewConstraint(attr, operator, value string) (Constraint, error) {
-	if operator == CONSTRAINT_OPERATOR_EQUALS {
+	switch operator {
+	case CONSTRAINT_OPERATOR_EQUALS:
 		return NewEqualsConstraint(attr, value), nil
+	case CONSTRAINT_OPERATOR_LIKE:
+		return NewLikeConstraint(attr, value)
+	case CONSTRAINT_OPERATOR_UNLIKE:
+		return NewUnlikeConstraint(attr, value)
+	case CONSTRAINT_OPERATOR_UNIQUE:
+		return NewUniqueConstraint(attr), nil
+	case CONSTRAINT_OPERATOR_GROUP_BY:
+		if value == "" {
+			return NewGroupByConstraint(attr, 0), nil
+		}
+		n, err := parseConstraintCount(value)
+		if err != nil {
+			return nil, err
+		}
+		return NewGroupByConstraint(attr, n), nil
+	case CONSTRAINT_OPERATOR_MAX_PER:
+		n, err := parseConstraintCount(value)
+		if err != nil {
+			return nil, err
+		}
+		return NewMaxPerConstraint(attr, n), nil
+	case CONSTRAINT_OPERATOR_GT, CONSTRAINT_OPERATOR_LT, CONSTRAINT_OPERATOR_GE, CONSTRAINT_OPERATOR_LE:
+		return NewCompareConstraint(attr, operator, value)
 	}
 	return nil, fmt.Errorf("Unsupported operator: %s", operator)
 }
 
+func parseConstraintCount(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("Invalid count: %s", value)
+	}
+	return n, nil
+}
+
+func formatScalar(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// quotes values which would not parse back to the same value
+// ' can't be quoted by itself, it is quoted with " instead: it's -> 'it'"'"'s'
+func quoteConstraintValue(v string) string {
+	if !strings.ContainsAny(v, "&;|!()'\"") && strings.TrimSpace(v) == v {
+		return v
+	}
+	return "'" + strings.Replace(v, "'", `'"'"'`, -1) + "'"
+}
+
+func findAttribute(attrs []*mesos.Attribute, name string) *mesos.Attribute {
+	for _, a := range attrs {
+		if a.GetName() == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// returns the value of the named attribute as string
+func attributeValue(hostname string, attrs []*mesos.Attribute, name string) (string, bool) {
+	if name == CONSTRAINT_ATTRIBUTE_HOSTNAME {
+		return hostname, true
+	}
+	a := findAttribute(attrs, name)
+	if a == nil {
+		return "", false
+	}
+	switch a.GetType() {
+	case mesos.Value_TEXT:
+		return a.GetText().GetValue(), true
+	case mesos.Value_SCALAR:
+		return formatScalar(a.GetScalar().GetValue()), true
+	case mesos.Value_SET:
+		return "{" + strings.Join(a.GetSet().GetItem(), ",") + "}", true
+	case mesos.Value_RANGES:
+		rs := []string{}
+		for _, r := range a.GetRanges().GetRange() {
+			rs = append(rs, fmt.Sprintf("%d-%d", r.GetBegin(), r.GetEnd()))
+		}
+		return "[" + strings.Join(rs, ",") + "]", true
+	}
+	return "", false
+}
+
+func offerAttributeValue(offer *mesos.Offer, name string) (string, bool) {
+	return attributeValue(offer.GetHostname(), offer.GetAttributes(), name)
+}
+
+func commandAttributeValue(c *Command, name string) (string, bool) {
+	return attributeValue(c.Hostname, c.Attributes, name)
+}
+
+// counts placed commands per value of the named attribute
+func countByAttributeValue(placed []*Command, name string) map[string]int {
+	counts := make(map[string]int)
+	for _, p := range placed {
+		if v, ok := commandAttributeValue(p, name); ok {
+			counts[v]++
+		}
+	}
+	return counts
+}
+
 // EqualsConstraint
 
 type EqualsConstraint struct {
@@ -82,21 +251,229 @@ func NewEqualsConstraint(attr, value string) Constraint {
 	}
 }
 
-func (c *EqualsConstraint) Match(offer *mesos.Offer) bool {
-	for _, a := range offer.GetAttributes() {
-		if c.Attribute == a.GetName() {
-			if a.GetType() == mesos.Value_TEXT {
-				return c.Value == a.GetText().GetValue()
-			} else if a.GetType() == mesos.Value_SCALAR {
-				return c.Value == fmt.Sprintf("%.f", a.GetScalar().GetValue())
-			} else {
-				return false
+// text attributes are compared as string, scalars as float,
+// set and ranges attributes must contain the value
+func (c *EqualsConstraint) Match(offer *mesos.Offer, placed []*Command) bool {
+	if c.Attribute == CONSTRAINT_ATTRIBUTE_HOSTNAME {
+		return c.Value == offer.GetHostname()
+	}
+	a := findAttribute(offer.GetAttributes(), c.Attribute)
+	if a == nil {
+		return false
+	}
+	switch a.GetType() {
+	case mesos.Value_TEXT:
+		return c.Value == a.GetText().GetValue()
+	case mesos.Value_SCALAR:
+		v, err := strconv.ParseFloat(c.Value, 64)
+		return err == nil && v == a.GetScalar().GetValue()
+	case mesos.Value_SET:
+		for _, i := range a.GetSet().GetItem() {
+			if c.Value == i {
+				return true
 			}
 		}
+		return false
+	case mesos.Value_RANGES:
+		v, err := strconv.ParseUint(c.Value, 10, 64)
+		if err != nil {
+			return false
+		}
+		for _, r := range a.GetRanges().GetRange() {
+			if r.GetBegin() <= v && v <= r.GetEnd() {
+				return true
+			}
+		}
+		return false
 	}
 	return false
 }
 
 func (c *EqualsConstraint) String() string {
-	return fmt.Sprintf("%s:%s:%s", c.Attribute, CONSTRAINT_OPERATOR_EQUALS, c.Value)
+	return fmt.Sprintf("%s:%s:%s", c.Attribute, CONSTRAINT_OPERATOR_EQUALS, quoteConstraintValue(c.Value))
+}
+
+// LikeConstraint
+
+type LikeConstraint struct {
+	Attribute string
+	Value     string
+	regexp    *regexp.Regexp
+}
+
+func NewLikeConstraint(attr, value string) (Constraint, error) {
+	re, err := regexp.Compile("^(?:" + value + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("Invalid regular expression %s: %s", value, err)
+	}
+	return &LikeConstraint{
+		Attribute: attr,
+		Value:     value,
+		regexp:    re,
+	}, nil
+}
+
+func (c *LikeConstraint) Match(offer *mesos.Offer, placed []*Command) bool {
+	v, ok := offerAttributeValue(offer, c.Attribute)
+	return ok && c.regexp.MatchString(v)
+}
+
+func (c *LikeConstraint) String() string {
+	return fmt.Sprintf("%s:%s:%s", c.Attribute, CONSTRAINT_OPERATOR_LIKE, quoteConstraintValue(c.Value))
+}
+
+// UnlikeConstraint
+
+type UnlikeConstraint struct {
+	LikeConstraint
+}
+
+func NewUnlikeConstraint(attr, value string) (Constraint, error) {
+	c, err := NewLikeConstraint(attr, value)
+	if err != nil {
+		return nil, err
+	}
+	return &UnlikeConstraint{*c.(*LikeConstraint)}, nil
+}
+
+// matches offers without the attribute, too
+func (c *UnlikeConstraint) Match(offer *mesos.Offer, placed []*Command) bool {
+	v, ok := offerAttributeValue(offer, c.Attribute)
+	return !ok || !c.regexp.MatchString(v)
+}
+
+func (c *UnlikeConstraint) String() string {
+	return fmt.Sprintf("%s:%s:%s", c.Attribute, CONSTRAINT_OPERATOR_UNLIKE, quoteConstraintValue(c.Value))
+}
+
+// UniqueConstraint
+
+type UniqueConstraint struct {
+	Attribute string
+}
+
+func NewUniqueConstraint(attr string) Constraint {
+	return &UniqueConstraint{
+		Attribute: attr,
+	}
+}
+
+func (c *UniqueConstraint) Match(offer *mesos.Offer, placed []*Command) bool {
+	v, ok := offerAttributeValue(offer, c.Attribute)
+	return ok && countByAttributeValue(placed, c.Attribute)[v] == 0
+}
+
+func (c *UniqueConstraint) String() string {
+	return fmt.Sprintf("%s:%s", c.Attribute, CONSTRAINT_OPERATOR_UNIQUE)
+}
+
+// GroupByConstraint
+
+// spreads commands evenly across all values of an attribute.
+// With Groups > 0, commands are not placed twice on the same value before Groups values are in use.
+type GroupByConstraint struct {
+	Attribute string
+	Groups    int
+}
+
+func NewGroupByConstraint(attr string, groups int) Constraint {
+	return &GroupByConstraint{
+		Attribute: attr,
+		Groups:    groups,
+	}
+}
+
+func (c *GroupByConstraint) Match(offer *mesos.Offer, placed []*Command) bool {
+	v, ok := offerAttributeValue(offer, c.Attribute)
+	if !ok {
+		return false
+	}
+	counts := countByAttributeValue(placed, c.Attribute)
+	if counts[v] == 0 {
+		return true
+	}
+	if len(counts) < c.Groups {
+		// wait for offers with unused values
+		return false
+	}
+	for _, n := range counts {
+		if n < counts[v] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *GroupByConstraint) String() string {
+	if c.Groups == 0 {
+		return fmt.Sprintf("%s:%s", c.Attribute, CONSTRAINT_OPERATOR_GROUP_BY)
+	}
+	return fmt.Sprintf("%s:%s:%d", c.Attribute, CONSTRAINT_OPERATOR_GROUP_BY, c.Groups)
+}
+
+// MaxPerConstraint
+
+type MaxPerConstraint struct {
+	Attribute string
+	Max       int
+}
+
+func NewMaxPerConstraint(attr string, max int) Constraint {
+	return &MaxPerConstraint{
+		Attribute: attr,
+		Max:       max,
+	}
+}
+
+func (c *MaxPerConstraint) Match(offer *mesos.Offer, placed []*Command) bool {
+	v, ok := offerAttributeValue(offer, c.Attribute)
+	return ok && countByAttributeValue(placed, c.Attribute)[v] < c.Max
+}
+
+func (c *MaxPerConstraint) String() string {
+	return fmt.Sprintf("%s:%s:%d", c.Attribute, CONSTRAINT_OPERATOR_MAX_PER, c.Max)
+}
+
+// CompareConstraint
+
+// compares scalar attributes with GT, LT, GE or LE
+type CompareConstraint struct {
+	Attribute string
+	Operator  string
+	Value     float64
+}
+
+func NewCompareConstraint(attr, operator, value string) (Constraint, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid number: %s", value)
+	}
+	return &CompareConstraint{
+		Attribute: attr,
+		Operator:  operator,
+		Value:     v,
+	}, nil
+}
+
+func (c *CompareConstraint) Match(offer *mesos.Offer, placed []*Command) bool {
+	a := findAttribute(offer.GetAttributes(), c.Attribute)
+	if a == nil || a.GetType() != mesos.Value_SCALAR {
+		return false
+	}
+	v := a.GetScalar().GetValue()
+	switch c.Operator {
+	case CONSTRAINT_OPERATOR_GT:
+		return v > c.Value
+	case CONSTRAINT_OPERATOR_LT:
+		return v < c.Value
+	case CONSTRAINT_OPERATOR_GE:
+		return v >= c.Value
+	case CONSTRAINT_OPERATOR_LE:
+		return v <= c.Value
+	}
+	return false
+}
+
+func (c *CompareConstraint) String() string {
+	return fmt.Sprintf("%s:%s:%s", c.Attribute, c.Operator, formatScalar(c.Value))
 }
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint expressions combine constraints with
+//   a & b   or  a ; b   both a and b must match
+//   a | b               a or b must match
+//   !a                  a must not match
+//   ( a )               grouping
+// Parts of a constraint may be quoted with ' or " to use any of the above characters, e.g. rack:LIKE:'rack-(1|2)'.
+
+const (
+	tokenTerm = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+	tokenEnd
+)
+
+type ParseError struct {
+	Column  int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Invalid constraints at column %d: %s", e.Column, e.Message)
+}
+
+type token struct {
+	kind   int
+	text   string
+	column int
+}
+
+// split expression into tokens, columns start at 1
+func tokenizeConstraints(expr string) ([]token, error) {
+	tokens := []token{}
+	var term []rune
+	termColumn := 0
+	// length of the term up to the end of its last quote, whitespace within quotes is kept
+	quoted := 0
+	var quote rune
+	quoteColumn := 0
+
+	endTerm := func() {
+		if termColumn > 0 {
+			text := string(term[:quoted]) + strings.TrimRight(string(term[quoted:]), " \t")
+			tokens = append(tokens, token{tokenTerm, text, termColumn})
+			term = nil
+			termColumn = 0
+			quoted = 0
+		}
+	}
+
+	for i, r := range []rune(expr) {
+		column := i + 1
+		if quote != 0 {
+			if r == quote {
+				quote = 0
+				quoted = len(term)
+			} else {
+				term = append(term, r)
+			}
+			continue
+		}
+
+		kind := -1
+		switch r {
+		case '&', ';':
+			kind = tokenAnd
+		case '|':
+			kind = tokenOr
+		case '!':
+			kind = tokenNot
+		case '(':
+			kind = tokenOpen
+		case ')':
+			kind = tokenClose
+		}
+
+		if kind >= 0 {
+			endTerm()
+			tokens = append(tokens, token{kind, string(r), column})
+		} else if r == '\'' || r == '"' {
+			if termColumn == 0 {
+				termColumn = column
+			}
+			quote = r
+			quoteColumn = column
+		} else if termColumn > 0 || r != ' ' && r != '\t' {
+			if termColumn == 0 {
+				termColumn = column
+			}
+			term = append(term, r)
+		}
+	}
+	if quote != 0 {
+		return nil, &ParseError{quoteColumn, "unterminated quote"}
+	}
+	endTerm()
+	tokens = append(tokens, token{tokenEnd, "", len([]rune(expr)) + 1})
+	return tokens, nil
+}
+
+type constraintParser struct {
+	tokens []token
+	pos    int
+}
+
+// parse constraint expression into a tree of constraints
+func parseConstraintExpression(expr string) (Constraint, error) {
+	tokens, err := tokenizeConstraints(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &constraintParser{tokens: tokens}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, &ParseError{t.column, fmt.Sprintf("unexpected '%s'", t.text)}
+	}
+	return c, nil
+}
+
+func (p *constraintParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *constraintParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+// or := and ( '|' and )*
+func (p *constraintParser) parseOr() (Constraint, error) {
+	c, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenOr {
+		return c, nil
+	}
+	cs := OrConstraints{c}
+	for p.peek().kind == tokenOr {
+		p.next()
+		c, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// and := not ( ( '&' | ';' ) not )*
+func (p *constraintParser) parseAnd() (Constraint, error) {
+	c, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenAnd {
+		return c, nil
+	}
+	cs := Constraints{c}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// not := '!' not | '(' or ')' | constraint
+func (p *constraintParser) parseNot() (Constraint, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNot:
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &NotConstraint{c}, nil
+	case tokenOpen:
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokenClose {
+			return nil, &ParseError{t.column, "missing ')'"}
+		}
+		return c, nil
+	case tokenTerm:
+		c, err := ParseConstraint(&t.text)
+		if err != nil {
+			return nil, &ParseError{t.column, err.Error()}
+		}
+		return c, nil
+	case tokenEnd:
+		return nil, &ParseError{t.column, "missing constraint"}
+	}
+	return nil, &ParseError{t.column, fmt.Sprintf("unexpected '%s'", t.text)}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenizeConstraints(t *testing.T) {
+	tokens, err := tokenizeConstraints("(a:EQUALS:b | c:LIKE:'d|e') & !f:UNIQUE")
+	assert.Nil(t, err)
+
+	kinds := []int{}
+	texts := []string{}
+	for _, t := range tokens {
+		kinds = append(kinds, t.kind)
+		texts = append(texts, t.text)
+	}
+	assert.Equal(t, []int{tokenOpen, tokenTerm, tokenOr, tokenTerm, tokenClose, tokenAnd, tokenNot, tokenTerm, tokenEnd}, kinds)
+	assert.Equal(t, []string{"(", "a:EQUALS:b", "|", "c:LIKE:d|e", ")", "&", "!", "f:UNIQUE", ""}, texts)
+	assert.Equal(t, 2, tokens[1].column)
+	assert.Equal(t, 15, tokens[3].column)
+}
+
+func TestTokenizeConstraintsKeepsQuotedWhitespace(t *testing.T) {
+	tokens, err := tokenizeConstraints("  a:EQUALS:' b ' & c:EQUALS:\"d \"e  ")
+	assert.Nil(t, err)
+	assert.Equal(t, "a:EQUALS: b ", tokens[0].text)
+	assert.Equal(t, "c:EQUALS:d e", tokens[2].text)
+}
+
+func TestTokenizeConstraintsUnterminatedQuote(t *testing.T) {
+	_, err := tokenizeConstraints("a:LIKE:'b")
+	assert.NotNil(t, err)
+	assert.Equal(t, 8, err.(*ParseError).Column)
+}
+
+func TestParseConstraintsLegacySyntax(t *testing.T) {
+	p := "foo:EQUALS:bar;f00:EQUALS:BAR"
+	cs, err := ParseConstraints(&p)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(cs))
+	assert.IsType(t, &EqualsConstraint{}, cs[0])
+	assert.IsType(t, &EqualsConstraint{}, cs[1])
+}
+
+func TestParseConstraintsExpression(t *testing.T) {
+	p := "(rack:EQUALS:a | rack:EQUALS:b) & !maintenance:EQUALS:true"
+	cs, err := ParseConstraints(&p)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(cs))
+	assert.IsType(t, OrConstraints{}, cs[0])
+	assert.IsType(t, &NotConstraint{}, cs[1])
+	assert.Equal(t, "(rack:EQUALS:a | rack:EQUALS:b) & !maintenance:EQUALS:true", cs.String())
+}
+
+func TestParseConstraintsPrecedence(t *testing.T) {
+	p := "a:EQUALS:1 | b:EQUALS:2 & c:EQUALS:3"
+	cs, err := ParseConstraints(&p)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(cs))
+	assert.Equal(t, "a:EQUALS:1 | (b:EQUALS:2 & c:EQUALS:3)", cs.String())
+
+	p = "!(a:EQUALS:1 | b:EQUALS:2)"
+	cs, err = ParseConstraints(&p)
+	assert.Nil(t, err)
+	assert.Equal(t, "!(a:EQUALS:1 | b:EQUALS:2)", cs.String())
+}
+
+func TestParseConstraintsErrors(t *testing.T) {
+	for expr, column := range map[string]int{
+		"a:EQUALS:b |":               13,
+		"(a:EQUALS:b":                12,
+		"a:EQUALS:b)":                11,
+		"a:EQUALS:b & foo":           14,
+		"a:EQUALS:b & c:FOO:d":       14,
+		"a:EQUALS:b;;c:EQUALS:d":     12,
+		"a:EQUALS:b & (c:EQUALS:d (": 26,
+	} {
+		cs, err := ParseConstraints(&expr)
+		assert.Nil(t, cs, expr)
+		if assert.NotNil(t, err, expr) {
+			assert.Equal(t, column, err.(*ParseError).Column, expr)
+		}
+	}
+}
+
+func TestMatchConstraintsExpression(t *testing.T) {
+	p := "(rack:EQUALS:a | rack:EQUALS:b) & !maintenance:EQUALS:true"
+	cs, err := ParseConstraints(&p)
+	assert.Nil(t, err)
+
+	newOffer := func(rack, maintenance string) *mesos.Offer {
+		o := newTextAttributeOffer("host", "rack", rack)
+		o.Attributes = append(o.Attributes, newTextAttributeOffer("host", "maintenance", maintenance).Attributes...)
+		return o
+	}
+
+	assert.True(t, cs.Match(newOffer("a", "false"), nil))
+	assert.True(t, cs.Match(newOffer("b", "false"), nil))
+	assert.False(t, cs.Match(newOffer("c", "false"), nil))
+	assert.False(t, cs.Match(newOffer("a", "true"), nil))
+	assert.True(t, cs.Match(newTextAttributeOffer("host", "rack", "a"), nil))
+}
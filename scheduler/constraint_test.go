@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -14,8 +15,8 @@ type MockConstraint struct {
 	mock.Mock
 }
 
-func (c *MockConstraint) Match(offer *mesos.Offer) bool {
-	args := c.Called(offer)
+func (c *MockConstraint) Match(offer *mesos.Offer, placed []*Command) bool {
+	args := c.Called(offer, placed)
 	return args.Bool(0)
 }
 
@@ -46,7 +47,7 @@ func TestMatchAllEmpty(t *testing.T) {
 		Attributes: nil,
 	}
 
-	assert.True(t, cs.Match(o), "empty constraints should always match")
+	assert.True(t, cs.Match(o, nil), "empty constraints should always match")
 }
 
 func TestMatchAllTrue(t *testing.T) {
@@ -55,11 +56,11 @@ func TestMatchAllTrue(t *testing.T) {
 	}
 
 	tc := new(MockConstraint)
-	tc.On("Match", o).Return(true)
+	tc.On("Match", o, mock.Anything).Return(true)
 
 	cs := &Constraints{tc}
 
-	assert.True(t, cs.Match(o))
+	assert.True(t, cs.Match(o, nil))
 	tc.AssertExpectations(t)
 }
 
@@ -69,11 +70,11 @@ func TestMatchAllFalse(t *testing.T) {
 	}
 
 	fc := new(MockConstraint)
-	fc.On("Match", o).Return(false)
+	fc.On("Match", o, mock.Anything).Return(false)
 
 	cs := &Constraints{fc}
 
-	assert.False(t, cs.Match(o))
+	assert.False(t, cs.Match(o, nil))
 	fc.AssertExpectations(t)
 }
 
@@ -83,13 +84,13 @@ func TestMatchMixed(t *testing.T) {
 	}
 
 	tc := new(MockConstraint)
-	tc.On("Match", o).Return(true)
+	tc.On("Match", o, mock.Anything).Return(true)
 
 	fc := new(MockConstraint)
-	fc.On("Match", o).Return(false)
+	fc.On("Match", o, mock.Anything).Return(false)
 
 	cs := &Constraints{tc, fc}
-	assert.False(t, cs.Match(o))
+	assert.False(t, cs.Match(o, nil))
 	tc.AssertExpectations(t)
 	fc.AssertExpectations(t)
 }
@@ -122,7 +123,7 @@ func TestMatchEqualsWithNilAttributes(t *testing.T) {
 		Attributes: nil,
 	}
 
-	assert.False(t, c.Match(o))
+	assert.False(t, c.Match(o, nil))
 }
 
 func TestMatchEqualsWithZeroAttributes(t *testing.T) {
@@ -132,7 +133,7 @@ func TestMatchEqualsWithZeroAttributes(t *testing.T) {
 		Attributes: []*mesos.Attribute{},
 	}
 
-	assert.False(t, c.Match(o))
+	assert.False(t, c.Match(o, nil))
 }
 
 func TestMatchEqualsWithOtherAttributes(t *testing.T) {
@@ -152,7 +153,7 @@ func TestMatchEqualsWithOtherAttributes(t *testing.T) {
 		}},
 	}
 
-	assert.False(t, c.Match(o))
+	assert.False(t, c.Match(o, nil))
 }
 
 func TestMatchEqualsWithOtherValue(t *testing.T) {
@@ -172,7 +173,7 @@ func TestMatchEqualsWithOtherValue(t *testing.T) {
 		}},
 	}
 
-	assert.False(t, c.Match(o))
+	assert.False(t, c.Match(o, nil))
 }
 
 func TestMatchEqualsMatchingText(t *testing.T) {
@@ -192,7 +193,7 @@ func TestMatchEqualsMatchingText(t *testing.T) {
 		}},
 	}
 
-	assert.True(t, c.Match(o))
+	assert.True(t, c.Match(o, nil))
 }
 
 func TestMatchEqualsMatchingInt(t *testing.T) {
@@ -212,5 +213,309 @@ func TestMatchEqualsMatchingInt(t *testing.T) {
 		}},
 	}
 
-	assert.True(t, c.Match(o))
+	assert.True(t, c.Match(o, nil))
+}
+
+func TestParseConstraintLike(t *testing.T) {
+	p := "rack:LIKE:rack-[12]"
+	c, err := ParseConstraint(&p)
+	assert.Nil(t, err)
+	assert.IsType(t, &LikeConstraint{}, c)
+	assert.Equal(t, "rack:LIKE:rack-[12]", c.(*LikeConstraint).String())
+}
+
+func TestParseConstraintLikeInvalidRegexp(t *testing.T) {
+	p := "rack:LIKE:rack-[12"
+	c, err := ParseConstraint(&p)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
+
+func TestParseConstraintUnique(t *testing.T) {
+	p := "hostname:UNIQUE"
+	c, err := ParseConstraint(&p)
+	assert.Nil(t, err)
+	assert.IsType(t, &UniqueConstraint{}, c)
+	assert.Equal(t, "hostname", c.(*UniqueConstraint).Attribute)
+}
+
+func TestParseConstraintUnsupported(t *testing.T) {
+	p := "foo:BAR:baz"
+	c, err := ParseConstraint(&p)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
+
+// LikeConstraint
+
+func newTextAttributeOffer(hostname, name, value string) *mesos.Offer {
+	at := mesos.Value_TEXT
+	return &mesos.Offer{
+		Hostname: &hostname,
+		Attributes: []*mesos.Attribute{&mesos.Attribute{
+			Name: &name,
+			Type: &at,
+			Text: &mesos.Value_Text{
+				Value: &value,
+			},
+		}},
+	}
+}
+
+func TestMatchLike(t *testing.T) {
+	c, err := NewLikeConstraint("rack", "rack-[12]")
+	assert.Nil(t, err)
+
+	assert.True(t, c.Match(newTextAttributeOffer("host", "rack", "rack-1"), nil))
+	assert.True(t, c.Match(newTextAttributeOffer("host", "rack", "rack-2"), nil))
+	assert.False(t, c.Match(newTextAttributeOffer("host", "rack", "rack-3"), nil))
+	assert.False(t, c.Match(newTextAttributeOffer("host", "rack", "rack-12"), nil), "regexp should match whole value")
+	assert.False(t, c.Match(newTextAttributeOffer("host", "foo", "rack-1"), nil))
+}
+
+func TestMatchLikeHostname(t *testing.T) {
+	c, err := NewLikeConstraint("hostname", "node-.*")
+	assert.Nil(t, err)
+
+	assert.True(t, c.Match(newTextAttributeOffer("node-1", "rack", "rack-1"), nil))
+	assert.False(t, c.Match(newTextAttributeOffer("gpu-1", "rack", "rack-1"), nil))
+}
+
+// UnlikeConstraint
+
+func TestMatchUnlike(t *testing.T) {
+	c, err := NewUnlikeConstraint("tag", "gpu")
+	assert.Nil(t, err)
+
+	assert.False(t, c.Match(newTextAttributeOffer("host", "tag", "gpu"), nil))
+	assert.True(t, c.Match(newTextAttributeOffer("host", "tag", "cpu"), nil))
+	assert.True(t, c.Match(newTextAttributeOffer("host", "foo", "gpu"), nil), "offers without attribute should match")
+}
+
+// UniqueConstraint
+
+func TestMatchUnique(t *testing.T) {
+	c := NewUniqueConstraint("rack")
+	o := newTextAttributeOffer("host-1", "rack", "rack-1")
+
+	assert.True(t, c.Match(o, nil))
+	assert.True(t, c.Match(o, []*Command{}))
+
+	other := &Command{Hostname: "host-2", Attributes: newTextAttributeOffer("host-2", "rack", "rack-2").Attributes}
+	assert.True(t, c.Match(o, []*Command{other}))
+
+	same := &Command{Hostname: "host-3", Attributes: o.Attributes}
+	assert.False(t, c.Match(o, []*Command{other, same}))
+
+	assert.False(t, c.Match(newTextAttributeOffer("host-1", "foo", "bar"), nil), "offers without attribute should not match")
+}
+
+func TestMatchUniqueHostname(t *testing.T) {
+	c := NewUniqueConstraint("hostname")
+	o := newTextAttributeOffer("host-1", "rack", "rack-1")
+
+	assert.True(t, c.Match(o, []*Command{&Command{Hostname: "host-2"}}))
+	assert.False(t, c.Match(o, []*Command{&Command{Hostname: "host-1"}}))
+}
+
+func TestParseConstraintGroupBy(t *testing.T) {
+	p := "zone:GROUP_BY:3"
+	c, err := ParseConstraint(&p)
+	assert.Nil(t, err)
+	assert.IsType(t, &GroupByConstraint{}, c)
+	assert.Equal(t, 3, c.(*GroupByConstraint).Groups)
+
+	p = "zone:GROUP_BY"
+	c, err = ParseConstraint(&p)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, c.(*GroupByConstraint).Groups)
+
+	p = "zone:GROUP_BY:foo"
+	c, err = ParseConstraint(&p)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
+
+func TestParseConstraintMaxPer(t *testing.T) {
+	p := "hostname:MAX_PER:4"
+	c, err := ParseConstraint(&p)
+	assert.Nil(t, err)
+	assert.IsType(t, &MaxPerConstraint{}, c)
+	assert.Equal(t, 4, c.(*MaxPerConstraint).Max)
+
+	p = "hostname:MAX_PER"
+	c, err = ParseConstraint(&p)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+
+	p = "hostname:MAX_PER:0"
+	c, err = ParseConstraint(&p)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
+
+// GroupByConstraint
+
+func newPlacedCommands(name string, values ...string) []*Command {
+	cs := []*Command{}
+	for _, v := range values {
+		cs = append(cs, &Command{Attributes: newTextAttributeOffer("host", name, v).Attributes})
+	}
+	return cs
+}
+
+func TestMatchGroupBy(t *testing.T) {
+	c := NewGroupByConstraint("zone", 0)
+	a := newTextAttributeOffer("host", "zone", "a")
+	b := newTextAttributeOffer("host", "zone", "b")
+
+	assert.True(t, c.Match(a, nil))
+	assert.True(t, c.Match(a, newPlacedCommands("zone", "a")), "only one zone known")
+	assert.True(t, c.Match(b, newPlacedCommands("zone", "a")))
+	assert.False(t, c.Match(a, newPlacedCommands("zone", "a", "a", "b")))
+	assert.True(t, c.Match(b, newPlacedCommands("zone", "a", "a", "b")))
+	assert.True(t, c.Match(a, newPlacedCommands("zone", "a", "b")))
+	assert.False(t, c.Match(newTextAttributeOffer("host", "foo", "a"), nil), "offers without attribute should not match")
+}
+
+func TestMatchGroupByWithGroups(t *testing.T) {
+	c := NewGroupByConstraint("zone", 3)
+	a := newTextAttributeOffer("host", "zone", "a")
+	c3 := newTextAttributeOffer("host", "zone", "c")
+
+	assert.True(t, c.Match(a, nil))
+	assert.False(t, c.Match(a, newPlacedCommands("zone", "a", "b")), "zone c is not in use yet")
+	assert.True(t, c.Match(c3, newPlacedCommands("zone", "a", "b")))
+	assert.True(t, c.Match(a, newPlacedCommands("zone", "a", "b", "c")))
+}
+
+// MaxPerConstraint
+
+func TestMatchMaxPer(t *testing.T) {
+	c := NewMaxPerConstraint("hostname", 2)
+	o := newTextAttributeOffer("host-1", "zone", "a")
+
+	assert.True(t, c.Match(o, nil))
+	assert.True(t, c.Match(o, []*Command{&Command{Hostname: "host-1"}, &Command{Hostname: "host-2"}}))
+	assert.False(t, c.Match(o, []*Command{&Command{Hostname: "host-1"}, &Command{Hostname: "host-1"}}))
+}
+
+func newScalarAttributeOffer(name string, value float64) *mesos.Offer {
+	at := mesos.Value_SCALAR
+	return &mesos.Offer{
+		Attributes: []*mesos.Attribute{&mesos.Attribute{
+			Name: &name,
+			Type: &at,
+			Scalar: &mesos.Value_Scalar{
+				Value: &value,
+			},
+		}},
+	}
+}
+
+func TestMatchEqualsMatchingFloat(t *testing.T) {
+	c := NewEqualsConstraint("mem_class", "2.5")
+
+	assert.True(t, c.Match(newScalarAttributeOffer("mem_class", 2.5), nil))
+	assert.False(t, c.Match(newScalarAttributeOffer("mem_class", 2.0), nil))
+	assert.False(t, c.Match(newScalarAttributeOffer("mem_class", 3.0), nil))
+}
+
+func TestMatchEqualsScalarWithText(t *testing.T) {
+	c := NewEqualsConstraint("foo", "bar")
+
+	assert.False(t, c.Match(newScalarAttributeOffer("foo", 0), nil))
+}
+
+func TestMatchEqualsSet(t *testing.T) {
+	c := NewEqualsConstraint("features", "ssd")
+
+	an := "features"
+	at := mesos.Value_SET
+	o := &mesos.Offer{
+		Attributes: []*mesos.Attribute{&mesos.Attribute{
+			Name: &an,
+			Type: &at,
+			Set: &mesos.Value_Set{
+				Item: []string{"gpu", "ssd"},
+			},
+		}},
+	}
+
+	assert.True(t, c.Match(o, nil))
+	assert.False(t, NewEqualsConstraint("features", "hdd").Match(o, nil))
+}
+
+func TestMatchEqualsRanges(t *testing.T) {
+	an := "vlans"
+	at := mesos.Value_RANGES
+	o := &mesos.Offer{
+		Attributes: []*mesos.Attribute{&mesos.Attribute{
+			Name: &an,
+			Type: &at,
+			Ranges: &mesos.Value_Ranges{
+				Range: []*mesos.Value_Range{
+					util.NewValueRange(10, 20),
+					util.NewValueRange(30, 30),
+				},
+			},
+		}},
+	}
+
+	assert.True(t, NewEqualsConstraint("vlans", "10").Match(o, nil))
+	assert.True(t, NewEqualsConstraint("vlans", "15").Match(o, nil))
+	assert.True(t, NewEqualsConstraint("vlans", "30").Match(o, nil))
+	assert.False(t, NewEqualsConstraint("vlans", "25").Match(o, nil))
+	assert.False(t, NewEqualsConstraint("vlans", "foo").Match(o, nil))
+}
+
+func TestMatchEqualsHostname(t *testing.T) {
+	c := NewEqualsConstraint("hostname", "host-1")
+
+	assert.True(t, c.Match(newTextAttributeOffer("host-1", "foo", "bar"), nil))
+	assert.False(t, c.Match(newTextAttributeOffer("host-2", "foo", "bar"), nil))
+}
+
+// CompareConstraint
+
+func TestParseConstraintCompare(t *testing.T) {
+	for _, op := range []string{"GT", "LT", "GE", "LE"} {
+		p := "ssd_count:" + op + ":2"
+		c, err := ParseConstraint(&p)
+		assert.Nil(t, err)
+		assert.IsType(t, &CompareConstraint{}, c)
+		assert.Equal(t, p, c.(*CompareConstraint).String())
+	}
+
+	p := "ssd_count:GT:two"
+	c, err := ParseConstraint(&p)
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
+
+func TestMatchCompare(t *testing.T) {
+	gt, _ := NewCompareConstraint("kernel_version", "GT", "3.16")
+	lt, _ := NewCompareConstraint("kernel_version", "LT", "3.16")
+	ge, _ := NewCompareConstraint("kernel_version", "GE", "3.16")
+	le, _ := NewCompareConstraint("kernel_version", "LE", "3.16")
+
+	for _, v := range []float64{3.1, 3.16, 4.2} {
+		o := newScalarAttributeOffer("kernel_version", v)
+		assert.Equal(t, v > 3.16, gt.Match(o, nil))
+		assert.Equal(t, v < 3.16, lt.Match(o, nil))
+		assert.Equal(t, v >= 3.16, ge.Match(o, nil))
+		assert.Equal(t, v <= 3.16, le.Match(o, nil))
+	}
+
+	o := newTextAttributeOffer("host", "kernel_version", "4")
+	assert.False(t, gt.Match(o, nil), "text attributes should not match")
+	assert.False(t, gt.Match(newScalarAttributeOffer("ssd_count", 4), nil), "offers without attribute should not match")
+}
+
+func TestMatchUniqueScalar(t *testing.T) {
+	c := NewUniqueConstraint("ssd_count")
+	o := newScalarAttributeOffer("ssd_count", 2.5)
+
+	assert.True(t, c.Match(o, []*Command{&Command{Attributes: newScalarAttributeOffer("ssd_count", 2).Attributes}}))
+	assert.False(t, c.Match(o, []*Command{&Command{Attributes: o.Attributes}}))
 }
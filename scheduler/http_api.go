@@ -0,0 +1,696 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+)
+
+// JSON messages of the v1 scheduler API, limited to what NONE uses
+// v1 calls slaves agents, the messages are converted from and to the mesosproto types of the driver API
+
+type v1Value struct {
+	Value string `json:"value"`
+}
+
+func (v *v1Value) GetValue() string {
+	if v == nil {
+		return ""
+	}
+	return v.Value
+}
+
+type v1Scalar struct {
+	Value float64 `json:"value"`
+}
+
+type v1Range struct {
+	Begin uint64 `json:"begin"`
+	End   uint64 `json:"end"`
+}
+
+type v1Ranges struct {
+	Range []*v1Range `json:"range"`
+}
+
+type v1Set struct {
+	Item []string `json:"item"`
+}
+
+type v1Text struct {
+	Value string `json:"value"`
+}
+
+type v1Label struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+type v1Labels struct {
+	Labels []*v1Label `json:"labels"`
+}
+
+type v1Reservation struct {
+	Principal string    `json:"principal,omitempty"`
+	Labels    *v1Labels `json:"labels,omitempty"`
+}
+
+type v1Persistence struct {
+	Id        string `json:"id"`
+	Principal string `json:"principal,omitempty"`
+}
+
+type v1DiskRoot struct {
+	Root string `json:"root"`
+}
+
+type v1DiskSource struct {
+	Type  string      `json:"type"`
+	Path  *v1DiskRoot `json:"path,omitempty"`
+	Mount *v1DiskRoot `json:"mount,omitempty"`
+}
+
+// persistent volumes and mount disks, launched tasks must use them exactly as offered
+type v1DiskInfo struct {
+	Persistence *v1Persistence `json:"persistence,omitempty"`
+	Volume      *v1Volume      `json:"volume,omitempty"`
+	Source      *v1DiskSource  `json:"source,omitempty"`
+}
+
+type v1RevocableInfo struct{}
+
+type v1Resource struct {
+	Name        string           `json:"name"`
+	Type        string           `json:"type"`
+	Scalar      *v1Scalar        `json:"scalar,omitempty"`
+	Ranges      *v1Ranges        `json:"ranges,omitempty"`
+	Set         *v1Set           `json:"set,omitempty"`
+	Role        string           `json:"role,omitempty"`
+	Reservation *v1Reservation   `json:"reservation,omitempty"`
+	Disk        *v1DiskInfo      `json:"disk,omitempty"`
+	Revocable   *v1RevocableInfo `json:"revocable,omitempty"`
+}
+
+type v1Attribute struct {
+	Name   string    `json:"name"`
+	Type   string    `json:"type"`
+	Scalar *v1Scalar `json:"scalar,omitempty"`
+	Ranges *v1Ranges `json:"ranges,omitempty"`
+	Set    *v1Set    `json:"set,omitempty"`
+	Text   *v1Text   `json:"text,omitempty"`
+}
+
+type v1Offer struct {
+	Id          v1Value        `json:"id"`
+	FrameworkId v1Value        `json:"framework_id"`
+	AgentId     v1Value        `json:"agent_id"`
+	Hostname    string         `json:"hostname"`
+	Resources   []*v1Resource  `json:"resources,omitempty"`
+	Attributes  []*v1Attribute `json:"attributes,omitempty"`
+}
+
+type v1TaskStatus struct {
+	TaskId    v1Value  `json:"task_id"`
+	State     string   `json:"state"`
+	Message   string   `json:"message,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	AgentId   *v1Value `json:"agent_id,omitempty"`
+	Timestamp float64  `json:"timestamp,omitempty"`
+	Uuid      []byte   `json:"uuid,omitempty"`
+}
+
+type v1MasterInfo struct {
+	Id       string `json:"id"`
+	Ip       uint32 `json:"ip"`
+	Port     uint32 `json:"port"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+type v1FrameworkInfo struct {
+	User            string   `json:"user"`
+	Name            string   `json:"name"`
+	Id              *v1Value `json:"id,omitempty"`
+	FailoverTimeout float64  `json:"failover_timeout,omitempty"`
+	Checkpoint      bool     `json:"checkpoint,omitempty"`
+	Role            string   `json:"role,omitempty"`
+	Hostname        string   `json:"hostname,omitempty"`
+	Principal       string   `json:"principal,omitempty"`
+}
+
+type v1Uri struct {
+	Value      string `json:"value"`
+	Executable bool   `json:"executable"`
+	Extract    bool   `json:"extract"`
+	Cache      bool   `json:"cache"`
+}
+
+type v1Variable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type v1Environment struct {
+	Variables []*v1Variable `json:"variables"`
+}
+
+type v1CommandInfo struct {
+	Uris        []*v1Uri       `json:"uris,omitempty"`
+	Environment *v1Environment `json:"environment,omitempty"`
+	Shell       bool           `json:"shell"`
+	Value       string         `json:"value,omitempty"`
+	Arguments   []string       `json:"arguments,omitempty"`
+}
+
+type v1Parameter struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type v1PortMapping struct {
+	HostPort      uint32 `json:"host_port"`
+	ContainerPort uint32 `json:"container_port"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+type v1DockerInfo struct {
+	Image          string           `json:"image"`
+	Network        string           `json:"network,omitempty"`
+	PortMappings   []*v1PortMapping `json:"port_mappings,omitempty"`
+	Privileged     bool             `json:"privileged,omitempty"`
+	Parameters     []*v1Parameter   `json:"parameters,omitempty"`
+	ForcePullImage bool             `json:"force_pull_image,omitempty"`
+}
+
+type v1AppcImage struct {
+	Name   string    `json:"name"`
+	Id     string    `json:"id,omitempty"`
+	Labels *v1Labels `json:"labels,omitempty"`
+}
+
+type v1DockerImage struct {
+	Name string `json:"name"`
+}
+
+type v1Image struct {
+	Type   string         `json:"type"`
+	Appc   *v1AppcImage   `json:"appc,omitempty"`
+	Docker *v1DockerImage `json:"docker,omitempty"`
+}
+
+type v1MesosInfo struct {
+	Image *v1Image `json:"image,omitempty"`
+}
+
+type v1Volume struct {
+	ContainerPath string `json:"container_path"`
+	HostPath      string `json:"host_path,omitempty"`
+	Mode          string `json:"mode"`
+}
+
+type v1ContainerInfo struct {
+	Type    string        `json:"type"`
+	Volumes []*v1Volume   `json:"volumes,omitempty"`
+	Docker  *v1DockerInfo `json:"docker,omitempty"`
+	Mesos   *v1MesosInfo  `json:"mesos,omitempty"`
+}
+
+type v1TaskInfo struct {
+	Name      string           `json:"name"`
+	TaskId    v1Value          `json:"task_id"`
+	AgentId   v1Value          `json:"agent_id"`
+	Resources []*v1Resource    `json:"resources"`
+	Command   *v1CommandInfo   `json:"command,omitempty"`
+	Container *v1ContainerInfo `json:"container,omitempty"`
+}
+
+type v1Filters struct {
+	RefuseSeconds float64 `json:"refuse_seconds"`
+}
+
+// ------ events --- //
+
+type v1Event struct {
+	Type       string        `json:"type"`
+	Subscribed *v1Subscribed `json:"subscribed,omitempty"`
+	Offers     *v1Offers     `json:"offers,omitempty"`
+	Rescind    *v1Rescind    `json:"rescind,omitempty"`
+	Update     *v1Update     `json:"update,omitempty"`
+	Message    *v1Message    `json:"message,omitempty"`
+	Failure    *v1Failure    `json:"failure,omitempty"`
+	Error      *v1Error      `json:"error,omitempty"`
+}
+
+type v1Subscribed struct {
+	FrameworkId              v1Value       `json:"framework_id"`
+	HeartbeatIntervalSeconds float64       `json:"heartbeat_interval_seconds,omitempty"`
+	MasterInfo               *v1MasterInfo `json:"master_info,omitempty"`
+}
+
+type v1Offers struct {
+	Offers []*v1Offer `json:"offers"`
+}
+
+type v1Rescind struct {
+	OfferId v1Value `json:"offer_id"`
+}
+
+type v1Update struct {
+	Status *v1TaskStatus `json:"status"`
+}
+
+type v1Message struct {
+	AgentId    v1Value `json:"agent_id"`
+	ExecutorId v1Value `json:"executor_id"`
+	Data       []byte  `json:"data"`
+}
+
+type v1Failure struct {
+	AgentId    *v1Value `json:"agent_id,omitempty"`
+	ExecutorId *v1Value `json:"executor_id,omitempty"`
+	Status     int      `json:"status,omitempty"`
+}
+
+type v1Error struct {
+	Message string `json:"message"`
+}
+
+// ------ calls --- //
+
+type v1Call struct {
+	FrameworkId *v1Value       `json:"framework_id,omitempty"`
+	Type        string         `json:"type"`
+	Subscribe   *v1Subscribe   `json:"subscribe,omitempty"`
+	Accept      *v1Accept      `json:"accept,omitempty"`
+	Decline     *v1Decline     `json:"decline,omitempty"`
+	Kill        *v1Kill        `json:"kill,omitempty"`
+	Acknowledge *v1Acknowledge `json:"acknowledge,omitempty"`
+	Reconcile   *v1Reconcile   `json:"reconcile,omitempty"`
+	Message     *v1Message     `json:"message,omitempty"`
+}
+
+type v1Subscribe struct {
+	FrameworkInfo *v1FrameworkInfo `json:"framework_info"`
+}
+
+type v1Launch struct {
+	TaskInfos []*v1TaskInfo `json:"task_infos"`
+}
+
+type v1Operation struct {
+	Type   string    `json:"type"`
+	Launch *v1Launch `json:"launch,omitempty"`
+}
+
+type v1Accept struct {
+	OfferIds   []*v1Value     `json:"offer_ids"`
+	Operations []*v1Operation `json:"operations"`
+	Filters    *v1Filters     `json:"filters,omitempty"`
+}
+
+type v1Decline struct {
+	OfferIds []*v1Value `json:"offer_ids"`
+	Filters  *v1Filters `json:"filters,omitempty"`
+}
+
+type v1Kill struct {
+	TaskId  v1Value  `json:"task_id"`
+	AgentId *v1Value `json:"agent_id,omitempty"`
+}
+
+type v1Acknowledge struct {
+	AgentId v1Value `json:"agent_id"`
+	TaskId  v1Value `json:"task_id"`
+	Uuid    []byte  `json:"uuid"`
+}
+
+type v1ReconcileTask struct {
+	TaskId  v1Value  `json:"task_id"`
+	AgentId *v1Value `json:"agent_id,omitempty"`
+}
+
+type v1Reconcile struct {
+	Tasks []*v1ReconcileTask `json:"tasks"`
+}
+
+// ------ conversion --- //
+
+// v1 renamed SLAVE to AGENT in enum names, too
+func fromV1Name(name string) string {
+	return strings.Replace(name, "AGENT", "SLAVE", -1)
+}
+
+func newV1Value(value string) *v1Value {
+	if value == "" {
+		return nil
+	}
+	return &v1Value{Value: value}
+}
+
+func newV1FrameworkInfo(fwinfo *mesos.FrameworkInfo, frameworkId string) *v1FrameworkInfo {
+	return &v1FrameworkInfo{
+		User:            fwinfo.GetUser(),
+		Name:            fwinfo.GetName(),
+		Id:              newV1Value(frameworkId),
+		FailoverTimeout: fwinfo.GetFailoverTimeout(),
+		Checkpoint:      fwinfo.GetCheckpoint(),
+		Role:            fwinfo.GetRole(),
+		Hostname:        fwinfo.GetHostname(),
+		Principal:       fwinfo.GetPrincipal(),
+	}
+}
+
+func newV1Filters(filters *mesos.Filters) *v1Filters {
+	if filters == nil || filters.RefuseSeconds == nil {
+		return nil
+	}
+	return &v1Filters{RefuseSeconds: *filters.RefuseSeconds}
+}
+
+func newV1Ranges(ranges *mesos.Value_Ranges) *v1Ranges {
+	if ranges == nil {
+		return nil
+	}
+	r := &v1Ranges{Range: []*v1Range{}}
+	for _, rg := range ranges.GetRange() {
+		r.Range = append(r.Range, &v1Range{Begin: rg.GetBegin(), End: rg.GetEnd()})
+	}
+	return r
+}
+
+func newV1Labels(labels *mesos.Labels) *v1Labels {
+	if labels == nil {
+		return nil
+	}
+	l := &v1Labels{Labels: []*v1Label{}}
+	for _, label := range labels.GetLabels() {
+		l.Labels = append(l.Labels, &v1Label{Key: label.GetKey(), Value: label.GetValue()})
+	}
+	return l
+}
+
+func newV1Volume(v *mesos.Volume) *v1Volume {
+	if v == nil {
+		return nil
+	}
+	return &v1Volume{
+		ContainerPath: v.GetContainerPath(),
+		HostPath:      v.GetHostPath(),
+		Mode:          v.GetMode().String(),
+	}
+}
+
+func newV1DiskInfo(disk *mesos.Resource_DiskInfo) *v1DiskInfo {
+	if disk == nil {
+		return nil
+	}
+	d := &v1DiskInfo{Volume: newV1Volume(disk.GetVolume())}
+	if p := disk.GetPersistence(); p != nil {
+		d.Persistence = &v1Persistence{Id: p.GetId(), Principal: p.GetPrincipal()}
+	}
+	if src := disk.GetSource(); src != nil {
+		d.Source = &v1DiskSource{Type: src.GetType().String()}
+		if src.Path != nil {
+			d.Source.Path = &v1DiskRoot{Root: src.GetPath().GetRoot()}
+		}
+		if src.Mount != nil {
+			d.Source.Mount = &v1DiskRoot{Root: src.GetMount().GetRoot()}
+		}
+	}
+	return d
+}
+
+func newV1Resource(res *mesos.Resource) *v1Resource {
+	r := &v1Resource{
+		Name: res.GetName(),
+		Type: res.GetType().String(),
+		Role: res.GetRole(),
+	}
+	if res.Scalar != nil {
+		r.Scalar = &v1Scalar{Value: res.GetScalar().GetValue()}
+	}
+	r.Ranges = newV1Ranges(res.GetRanges())
+	if res.Set != nil {
+		r.Set = &v1Set{Item: res.GetSet().GetItem()}
+	}
+	if res.Reservation != nil {
+		r.Reservation = &v1Reservation{
+			Principal: res.GetReservation().GetPrincipal(),
+			Labels:    newV1Labels(res.GetReservation().GetLabels()),
+		}
+	}
+	r.Disk = newV1DiskInfo(res.GetDisk())
+	if res.Revocable != nil {
+		r.Revocable = &v1RevocableInfo{}
+	}
+	return r
+}
+
+func newV1CommandInfo(ci *mesos.CommandInfo) *v1CommandInfo {
+	if ci == nil {
+		return nil
+	}
+	c := &v1CommandInfo{
+		Shell:     ci.GetShell(),
+		Value:     ci.GetValue(),
+		Arguments: ci.GetArguments(),
+	}
+	for _, u := range ci.GetUris() {
+		c.Uris = append(c.Uris, &v1Uri{
+			Value:      u.GetValue(),
+			Executable: u.GetExecutable(),
+			Extract:    u.GetExtract(),
+			Cache:      u.GetCache(),
+		})
+	}
+	if ci.Environment != nil {
+		c.Environment = &v1Environment{Variables: []*v1Variable{}}
+		for _, v := range ci.GetEnvironment().GetVariables() {
+			c.Environment.Variables = append(c.Environment.Variables, &v1Variable{Name: v.GetName(), Value: v.GetValue()})
+		}
+	}
+	return c
+}
+
+func newV1ContainerInfo(ci *mesos.ContainerInfo) *v1ContainerInfo {
+	if ci == nil {
+		return nil
+	}
+	c := &v1ContainerInfo{Type: ci.GetType().String()}
+	for _, v := range ci.GetVolumes() {
+		c.Volumes = append(c.Volumes, newV1Volume(v))
+	}
+	if d := ci.GetDocker(); d != nil {
+		c.Docker = &v1DockerInfo{
+			Image:          d.GetImage(),
+			Privileged:     d.GetPrivileged(),
+			ForcePullImage: d.GetForcePullImage(),
+		}
+		if d.Network != nil {
+			c.Docker.Network = d.GetNetwork().String()
+		}
+		for _, p := range d.GetParameters() {
+			c.Docker.Parameters = append(c.Docker.Parameters, &v1Parameter{Key: p.GetKey(), Value: p.GetValue()})
+		}
+		for _, pm := range d.GetPortMappings() {
+			c.Docker.PortMappings = append(c.Docker.PortMappings, &v1PortMapping{
+				HostPort:      pm.GetHostPort(),
+				ContainerPort: pm.GetContainerPort(),
+				Protocol:      pm.GetProtocol(),
+			})
+		}
+	}
+	if m := ci.GetMesos(); m != nil {
+		c.Mesos = &v1MesosInfo{Image: newV1Image(m.GetImage())}
+	}
+	return c
+}
+
+func newV1Image(image *mesos.Image) *v1Image {
+	if image == nil {
+		return nil
+	}
+	i := &v1Image{Type: image.GetType().String()}
+	if a := image.GetAppc(); a != nil {
+		i.Appc = &v1AppcImage{Name: a.GetName(), Id: a.GetId(), Labels: newV1Labels(a.GetLabels())}
+	}
+	if d := image.GetDocker(); d != nil {
+		i.Docker = &v1DockerImage{Name: d.GetName()}
+	}
+	return i
+}
+
+func newV1TaskInfo(task *mesos.TaskInfo) *v1TaskInfo {
+	t := &v1TaskInfo{
+		Name:      task.GetName(),
+		TaskId:    v1Value{Value: task.GetTaskId().GetValue()},
+		AgentId:   v1Value{Value: task.GetSlaveId().GetValue()},
+		Resources: []*v1Resource{},
+		Command:   newV1CommandInfo(task.GetCommand()),
+		Container: newV1ContainerInfo(task.Container),
+	}
+	for _, res := range task.GetResources() {
+		t.Resources = append(t.Resources, newV1Resource(res))
+	}
+	return t
+}
+
+func (r *v1Ranges) toRanges() *mesos.Value_Ranges {
+	if r == nil {
+		return nil
+	}
+	ranges := &mesos.Value_Ranges{Range: []*mesos.Value_Range{}}
+	for _, rg := range r.Range {
+		ranges.Range = append(ranges.Range, &mesos.Value_Range{Begin: proto.Uint64(rg.Begin), End: proto.Uint64(rg.End)})
+	}
+	return ranges
+}
+
+func toValueType(name string) *mesos.Value_Type {
+	return mesos.Value_Type(mesos.Value_Type_value[name]).Enum()
+}
+
+func (l *v1Labels) toLabels() *mesos.Labels {
+	if l == nil {
+		return nil
+	}
+	labels := &mesos.Labels{Labels: []*mesos.Label{}}
+	for _, label := range l.Labels {
+		labels.Labels = append(labels.Labels, &mesos.Label{Key: proto.String(label.Key), Value: proto.String(label.Value)})
+	}
+	return labels
+}
+
+func (v *v1Volume) toVolume() *mesos.Volume {
+	if v == nil {
+		return nil
+	}
+	volume := &mesos.Volume{
+		ContainerPath: proto.String(v.ContainerPath),
+		Mode:          mesos.Volume_Mode(mesos.Volume_Mode_value[v.Mode]).Enum(),
+	}
+	if v.HostPath != "" {
+		volume.HostPath = proto.String(v.HostPath)
+	}
+	return volume
+}
+
+func (d *v1DiskInfo) toDiskInfo() *mesos.Resource_DiskInfo {
+	if d == nil {
+		return nil
+	}
+	disk := &mesos.Resource_DiskInfo{Volume: d.Volume.toVolume()}
+	if p := d.Persistence; p != nil {
+		disk.Persistence = &mesos.Resource_DiskInfo_Persistence{Id: proto.String(p.Id)}
+		if p.Principal != "" {
+			disk.Persistence.Principal = proto.String(p.Principal)
+		}
+	}
+	if src := d.Source; src != nil {
+		disk.Source = &mesos.Resource_DiskInfo_Source{
+			Type: mesos.Resource_DiskInfo_Source_Type(mesos.Resource_DiskInfo_Source_Type_value[src.Type]).Enum(),
+		}
+		if src.Path != nil {
+			disk.Source.Path = &mesos.Resource_DiskInfo_Source_Path{Root: proto.String(src.Path.Root)}
+		}
+		if src.Mount != nil {
+			disk.Source.Mount = &mesos.Resource_DiskInfo_Source_Mount{Root: proto.String(src.Mount.Root)}
+		}
+	}
+	return disk
+}
+
+func (r *v1Resource) toResource() *mesos.Resource {
+	res := &mesos.Resource{
+		Name:   proto.String(r.Name),
+		Type:   toValueType(r.Type),
+		Ranges: r.Ranges.toRanges(),
+	}
+	if r.Scalar != nil {
+		res.Scalar = &mesos.Value_Scalar{Value: proto.Float64(r.Scalar.Value)}
+	}
+	if r.Set != nil {
+		res.Set = &mesos.Value_Set{Item: r.Set.Item}
+	}
+	if r.Role != "" {
+		res.Role = proto.String(r.Role)
+	}
+	if r.Reservation != nil {
+		res.Reservation = &mesos.Resource_ReservationInfo{
+			Principal: proto.String(r.Reservation.Principal),
+			Labels:    r.Reservation.Labels.toLabels(),
+		}
+	}
+	res.Disk = r.Disk.toDiskInfo()
+	if r.Revocable != nil {
+		res.Revocable = &mesos.Resource_RevocableInfo{}
+	}
+	return res
+}
+
+func (a *v1Attribute) toAttribute() *mesos.Attribute {
+	attr := &mesos.Attribute{
+		Name:   proto.String(a.Name),
+		Type:   toValueType(a.Type),
+		Ranges: a.Ranges.toRanges(),
+	}
+	if a.Scalar != nil {
+		attr.Scalar = &mesos.Value_Scalar{Value: proto.Float64(a.Scalar.Value)}
+	}
+	if a.Set != nil {
+		attr.Set = &mesos.Value_Set{Item: a.Set.Item}
+	}
+	if a.Text != nil {
+		attr.Text = &mesos.Value_Text{Value: proto.String(a.Text.Value)}
+	}
+	return attr
+}
+
+func (o *v1Offer) toOffer() *mesos.Offer {
+	offer := util.NewOffer(
+		util.NewOfferID(o.Id.Value),
+		util.NewFrameworkID(o.FrameworkId.Value),
+		util.NewSlaveID(o.AgentId.Value),
+		o.Hostname)
+	for _, r := range o.Resources {
+		offer.Resources = append(offer.Resources, r.toResource())
+	}
+	for _, a := range o.Attributes {
+		offer.Attributes = append(offer.Attributes, a.toAttribute())
+	}
+	return offer
+}
+
+func (s *v1TaskStatus) toTaskStatus() *mesos.TaskStatus {
+	status := util.NewTaskStatus(util.NewTaskID(s.TaskId.Value), mesos.TaskState(mesos.TaskState_value[s.State]))
+	if s.Message != "" {
+		status.Message = proto.String(s.Message)
+	}
+	if v, ok := mesos.TaskStatus_Source_value[fromV1Name(s.Source)]; ok {
+		status.Source = mesos.TaskStatus_Source(v).Enum()
+	}
+	if v, ok := mesos.TaskStatus_Reason_value[fromV1Name(s.Reason)]; ok {
+		status.Reason = mesos.TaskStatus_Reason(v).Enum()
+	}
+	if s.AgentId != nil {
+		status.SlaveId = util.NewSlaveID(s.AgentId.Value)
+	}
+	if s.Timestamp != 0 {
+		status.Timestamp = proto.Float64(s.Timestamp)
+	}
+	status.Uuid = s.Uuid
+	return status
+}
+
+func (m *v1MasterInfo) toMasterInfo() *mesos.MasterInfo {
+	if m == nil {
+		return nil
+	}
+	info := util.NewMasterInfo(m.Id, m.Ip, m.Port)
+	if m.Hostname != "" {
+		info.Hostname = proto.String(m.Hostname)
+	}
+	return info
+}
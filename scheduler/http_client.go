@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	// scheme of master and slave endpoints
+	mesosScheme = "http"
+	// shared by all calls to masters and slaves
+	httpClient = http.DefaultClient
+)
+
+// prepares the client side of TLS connections to masters and slaves
+// caFile adds trusted certificates, certFile and keyFile authenticate the client
+func NewClientTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// returns a client using config for https connections
+// requests are authenticated with credentials if set
+func NewHttpClient(config *tls.Config, credentials *HttpCredentials) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	if credentials == nil {
+		return &http.Client{Transport: transport}
+	}
+	return &http.Client{Transport: &authTransport{base: transport, credentials: credentials}}
+}
+
+// returns the url of path on a master or slave
+func mesosUrl(hostPort, path string) string {
+	return fmt.Sprintf("%s://%s%s", mesosScheme, hostPort, path)
+}
+
+// checks the status of a response from a master or slave
+func checkResponse(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return newHttpAuthError(resp)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s responded with %s: %s", resp.Request.URL.Host, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// ------ authentication --- //
+
+// basic auth with Principal and Secret, or a bearer Token
+type HttpCredentials struct {
+	Principal string
+	Secret    string
+	Token     string
+}
+
+// a master or slave rejected the credentials
+type HttpAuthError struct {
+	StatusCode int
+	Url        string
+	Message    string
+}
+
+func newHttpAuthError(resp *http.Response) *HttpAuthError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &HttpAuthError{StatusCode: resp.StatusCode, Url: resp.Request.URL.String(), Message: string(bytes.TrimSpace(body))}
+}
+
+func (e *HttpAuthError) Error() string {
+	msg := fmt.Sprintf("%s requires authentication, set -mesos-authentication-principal and -mesos-authentication-secret-file or -mesos-authentication-token-file", e.Url)
+	if e.StatusCode == http.StatusForbidden {
+		msg = fmt.Sprintf("Access to %s is forbidden, the principal is not authorized", e.Url)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+type authTransport struct {
+	base        http.RoundTripper
+	credentials *HttpCredentials
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+
+	if t.credentials.Token != "" {
+		r.Header.Set("Authorization", "Bearer "+t.credentials.Token)
+	} else {
+		r.SetBasicAuth(t.credentials.Principal, t.credentials.Secret)
+	}
+	return t.base.RoundTrip(r)
+}
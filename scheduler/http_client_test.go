@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClientTrustsCaFile(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	dir, _ := ioutil.TempDir("", "none-tls")
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0644)
+
+	_, err := NewHttpClient(nil, nil).Get(ts.URL)
+	assert.NotNil(t, err, "unknown certificate should be rejected")
+
+	config, err := NewClientTLSConfig(caFile, "", "", false)
+	assert.Nil(t, err)
+	resp, err := NewHttpClient(config, nil).Get(ts.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	config, err = NewClientTLSConfig("", "", "", true)
+	assert.Nil(t, err)
+	resp, err = NewHttpClient(config, nil).Get(ts.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+}
+
+func TestClientTLSConfigInvalidFiles(t *testing.T) {
+	_, err := NewClientTLSConfig("does-not-exist.pem", "", "", false)
+	assert.NotNil(t, err)
+
+	_, err = NewClientTLSConfig("http_client_test.go", "", "", false)
+	assert.NotNil(t, err)
+
+	_, err = NewClientTLSConfig("", "does-not-exist.pem", "does-not-exist.key", false)
+	assert.NotNil(t, err)
+}
+
+func TestMesosUrl(t *testing.T) {
+	assert.Equal(t, "http://master:5050/master/state.json", mesosUrl("master:5050", "/master/state.json"))
+
+	mesosScheme = "https"
+	defer func() { mesosScheme = "http" }()
+	assert.Equal(t, "https://master:5050/master/state.json", mesosUrl("master:5050", "/master/state.json"))
+}
+
+func TestHttpClientAuthentication(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	resp, err := NewHttpClient(nil, &HttpCredentials{Principal: "none", Secret: "secret"}).Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Basic bm9uZTpzZWNyZXQ=", auth)
+	assert.Equal(t, "", req.Header.Get("Authorization"), "request should not be modified")
+
+	resp, err = NewHttpClient(nil, &HttpCredentials{Principal: "none", Secret: "secret", Token: "t0k3n"}).Get(ts.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Bearer t0k3n", auth)
+}
+
+func TestCheckResponseExplainsAuthFailures(t *testing.T) {
+	status := http.StatusUnauthorized
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("nope"))
+	}))
+	defer ts.Close()
+
+	for _, status = range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		resp, _ := http.Get(ts.URL + "/master/state.json")
+		err := checkResponse(resp)
+		resp.Body.Close()
+		authErr, ok := err.(*HttpAuthError)
+		assert.True(t, ok)
+		assert.Equal(t, status, authErr.StatusCode)
+		assert.Contains(t, err.Error(), "/master/state.json")
+		assert.Contains(t, err.Error(), ": nope")
+	}
+
+	status = http.StatusInternalServerError
+	resp, _ := http.Get(ts.URL)
+	err := checkResponse(resp)
+	resp.Body.Close()
+	assert.Contains(t, err.Error(), "500 Internal Server Error: nope")
+}
+
+func TestFetchMasterStateUnauthorized(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	master := strings.TrimPrefix(ts.URL, "http://")
+	_, err := FetchMasterState(&master)
+	_, ok := err.(*HttpAuthError)
+	assert.True(t, ok, "expected an authentication error instead of %s", err)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/golang/glog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+	sched "github.com/mesos/mesos-go/scheduler"
+)
+
+const (
+	HTTP_API_PATH            = "/api/v1/scheduler"
+	HTTP_API_RECONNECT_DELAY = 2 * time.Second
+	// reconnect after missing this many heartbeats
+	HTTP_API_MISSED_HEARTBEATS = 5
+)
+
+// drives a scheduler through the v1 HTTP scheduler API
+// unlike the libprocess driver, the master never connects back to the scheduler
+type HttpSchedulerDriver struct {
+	scheduler   sched.Scheduler
+	framework   *mesos.FrameworkInfo
+	detector    LeaderDetector
+	client      *http.Client
+	mutex       chan bool
+	status      mesos.Status
+	err         error
+	frameworkId string
+	subscribed  bool
+	masterUrl   string
+	streamId    string
+	stream      io.Closer
+	done        chan bool
+}
+
+func NewHttpSchedulerDriver(scheduler sched.Scheduler, framework *mesos.FrameworkInfo, detector LeaderDetector) *HttpSchedulerDriver {
+	return &HttpSchedulerDriver{
+		scheduler:   scheduler,
+		framework:   framework,
+		detector:    detector,
+		client:      httpClient,
+		mutex:       make(chan bool, 1),
+		status:      mesos.Status_DRIVER_NOT_STARTED,
+		frameworkId: framework.GetId().GetValue(),
+		done:        make(chan bool),
+	}
+}
+
+// subscribes with the current master, reconnecting until the driver is stopped
+func (d *HttpSchedulerDriver) Start() (mesos.Status, error) {
+	d.mutex <- true
+	defer func() { <-d.mutex }()
+
+	if d.status != mesos.Status_DRIVER_NOT_STARTED {
+		return d.status, fmt.Errorf("Driver was already started")
+	}
+	d.status = mesos.Status_DRIVER_RUNNING
+	go d.run()
+	return d.status, nil
+}
+
+// tears the framework down unless failover is set, its tasks keep running for the failover timeout then
+func (d *HttpSchedulerDriver) Stop(failover bool) (mesos.Status, error) {
+	var err error
+	if !failover && d.Status() == mesos.Status_DRIVER_RUNNING {
+		err = d.call(&v1Call{Type: "TEARDOWN"})
+	}
+	return d.finish(mesos.Status_DRIVER_STOPPED, err), err
+}
+
+// stops without tearing the framework down
+func (d *HttpSchedulerDriver) Abort() (mesos.Status, error) {
+	return d.finish(mesos.Status_DRIVER_ABORTED, fmt.Errorf("Driver was aborted")), nil
+}
+
+// waits for the driver to be stopped or aborted
+func (d *HttpSchedulerDriver) Join() (mesos.Status, error) {
+	<-d.done
+	d.mutex <- true
+	defer func() { <-d.mutex }()
+	return d.status, d.err
+}
+
+func (d *HttpSchedulerDriver) Run() (mesos.Status, error) {
+	if status, err := d.Start(); err != nil {
+		return status, err
+	}
+	return d.Join()
+}
+
+func (d *HttpSchedulerDriver) RequestResources(requests []*mesos.Request) (mesos.Status, error) {
+	return d.Status(), fmt.Errorf("Requesting resources is not supported by the HTTP API driver")
+}
+
+// accepts the offers, launching the tasks
+// offers accepted without tasks are declined
+func (d *HttpSchedulerDriver) LaunchTasks(offerIds []*mesos.OfferID, tasks []*mesos.TaskInfo, filters *mesos.Filters) (mesos.Status, error) {
+	accept := &v1Accept{
+		OfferIds:   newV1OfferIds(offerIds),
+		Operations: []*v1Operation{},
+		Filters:    newV1Filters(filters),
+	}
+	if len(tasks) > 0 {
+		launch := &v1Launch{TaskInfos: []*v1TaskInfo{}}
+		for _, task := range tasks {
+			launch.TaskInfos = append(launch.TaskInfos, newV1TaskInfo(task))
+		}
+		accept.Operations = append(accept.Operations, &v1Operation{Type: "LAUNCH", Launch: launch})
+	}
+	return d.Status(), d.call(&v1Call{Type: "ACCEPT", Accept: accept})
+}
+
+func (d *HttpSchedulerDriver) KillTask(taskId *mesos.TaskID) (mesos.Status, error) {
+	kill := &v1Kill{TaskId: v1Value{Value: taskId.GetValue()}}
+	return d.Status(), d.call(&v1Call{Type: "KILL", Kill: kill})
+}
+
+func (d *HttpSchedulerDriver) DeclineOffer(offerId *mesos.OfferID, filters *mesos.Filters) (mesos.Status, error) {
+	decline := &v1Decline{
+		OfferIds: newV1OfferIds([]*mesos.OfferID{offerId}),
+		Filters:  newV1Filters(filters),
+	}
+	return d.Status(), d.call(&v1Call{Type: "DECLINE", Decline: decline})
+}
+
+func (d *HttpSchedulerDriver) ReviveOffers() (mesos.Status, error) {
+	return d.Status(), d.call(&v1Call{Type: "REVIVE"})
+}
+
+func (d *HttpSchedulerDriver) SendFrameworkMessage(executorId *mesos.ExecutorID, slaveId *mesos.SlaveID, data string) (mesos.Status, error) {
+	message := &v1Message{
+		AgentId:    v1Value{Value: slaveId.GetValue()},
+		ExecutorId: v1Value{Value: executorId.GetValue()},
+		Data:       []byte(data),
+	}
+	return d.Status(), d.call(&v1Call{Type: "MESSAGE", Message: message})
+}
+
+// reconciles the given tasks, all tasks for an empty list
+func (d *HttpSchedulerDriver) ReconcileTasks(statuses []*mesos.TaskStatus) (mesos.Status, error) {
+	reconcile := &v1Reconcile{Tasks: []*v1ReconcileTask{}}
+	for _, s := range statuses {
+		reconcile.Tasks = append(reconcile.Tasks, &v1ReconcileTask{
+			TaskId:  v1Value{Value: s.GetTaskId().GetValue()},
+			AgentId: newV1Value(s.GetSlaveId().GetValue()),
+		})
+	}
+	return d.Status(), d.call(&v1Call{Type: "RECONCILE", Reconcile: reconcile})
+}
+
+func (d *HttpSchedulerDriver) Status() mesos.Status {
+	d.mutex <- true
+	defer func() { <-d.mutex }()
+	return d.status
+}
+
+// private
+
+func (d *HttpSchedulerDriver) run() {
+	for {
+		err := d.subscribe()
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+		log.Errorln("Lost connection to master:", err)
+		d.scheduler.Disconnected(d)
+
+		select {
+		case <-d.done:
+			return
+		case <-time.After(HTTP_API_RECONNECT_DELAY):
+		}
+	}
+}
+
+// opens the event stream and dispatches events until the stream ends
+func (d *HttpSchedulerDriver) subscribe() error {
+	d.mutex <- true
+	call := &v1Call{
+		FrameworkId: newV1Value(d.frameworkId),
+		Type:        "SUBSCRIBE",
+		Subscribe:   &v1Subscribe{FrameworkInfo: newV1FrameworkInfo(d.framework, d.frameworkId)},
+	}
+	<-d.mutex
+
+	url := mesosUrl(d.detector.Leader(), HTTP_API_PATH)
+	log.Infoln("Subscribing with master at", url)
+	resp, err := d.post(url, call, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newHttpApiError(resp)
+	}
+
+	// calls go to the master which accepted the subscription, following redirects
+	d.mutex <- true
+	d.masterUrl = fmt.Sprintf("%s://%s%s", resp.Request.URL.Scheme, resp.Request.URL.Host, HTTP_API_PATH)
+	d.streamId = resp.Header.Get("Mesos-Stream-Id")
+	d.stream = resp.Body
+	<-d.mutex
+
+	// the master sends heartbeats, reconnect once they are missing
+	var heartbeat *time.Timer
+	var timeout time.Duration
+	defer func() {
+		if heartbeat != nil {
+			heartbeat.Stop()
+		}
+	}()
+
+	records := NewRecordReader(resp.Body)
+	for {
+		record, err := records.Read()
+		if err != nil {
+			return err
+		}
+		var event v1Event
+		if err := json.Unmarshal(record, &event); err != nil {
+			return fmt.Errorf("Invalid event: %s", err)
+		}
+
+		if heartbeat != nil {
+			heartbeat.Reset(timeout)
+		} else if event.Subscribed != nil && event.Subscribed.HeartbeatIntervalSeconds > 0 {
+			timeout = time.Duration(event.Subscribed.HeartbeatIntervalSeconds*HTTP_API_MISSED_HEARTBEATS) * time.Second
+			heartbeat = time.AfterFunc(timeout, func() {
+				log.Errorln("Missed heartbeats from master, reconnecting")
+				resp.Body.Close()
+			})
+		}
+		d.handleEvent(&event)
+	}
+}
+
+// passes the event on to the scheduler
+func (d *HttpSchedulerDriver) handleEvent(event *v1Event) {
+	switch event.Type {
+	case "SUBSCRIBED":
+		d.mutex <- true
+		d.frameworkId = event.Subscribed.FrameworkId.Value
+		resubscribed := d.subscribed
+		d.subscribed = true
+		<-d.mutex
+
+		masterInfo := event.Subscribed.MasterInfo.toMasterInfo()
+		if resubscribed {
+			d.scheduler.Reregistered(d, masterInfo)
+		} else {
+			d.scheduler.Registered(d, util.NewFrameworkID(event.Subscribed.FrameworkId.Value), masterInfo)
+		}
+	case "OFFERS":
+		offers := []*mesos.Offer{}
+		for _, o := range event.Offers.Offers {
+			offers = append(offers, o.toOffer())
+		}
+		d.scheduler.ResourceOffers(d, offers)
+	case "RESCIND":
+		d.scheduler.OfferRescinded(d, util.NewOfferID(event.Rescind.OfferId.Value))
+	case "UPDATE":
+		status := event.Update.Status.toTaskStatus()
+		d.scheduler.StatusUpdate(d, status)
+		d.acknowledge(status)
+	case "MESSAGE":
+		d.scheduler.FrameworkMessage(d,
+			util.NewExecutorID(event.Message.ExecutorId.Value),
+			util.NewSlaveID(event.Message.AgentId.Value),
+			string(event.Message.Data))
+	case "FAILURE":
+		f := event.Failure
+		if f.ExecutorId != nil {
+			d.scheduler.ExecutorLost(d, util.NewExecutorID(f.ExecutorId.Value), util.NewSlaveID(f.AgentId.GetValue()), f.Status)
+		} else if f.AgentId != nil {
+			d.scheduler.SlaveLost(d, util.NewSlaveID(f.AgentId.Value))
+		}
+	case "ERROR":
+		d.scheduler.Error(d, event.Error.Message)
+		d.Abort()
+	case "HEARTBEAT":
+	default:
+		log.Infoln("Ignoring unknown event", event.Type)
+	}
+}
+
+// status updates with uuid need to be acknowledged, otherwise the agent keeps resending them
+func (d *HttpSchedulerDriver) acknowledge(status *mesos.TaskStatus) {
+	if len(status.GetUuid()) == 0 || d.Status() != mesos.Status_DRIVER_RUNNING {
+		return
+	}
+	ack := &v1Acknowledge{
+		AgentId: v1Value{Value: status.GetSlaveId().GetValue()},
+		TaskId:  v1Value{Value: status.GetTaskId().GetValue()},
+		Uuid:    status.GetUuid(),
+	}
+	if err := d.call(&v1Call{Type: "ACKNOWLEDGE", Acknowledge: ack}); err != nil {
+		log.Errorln("Unable to acknowledge status update:", err)
+	}
+}
+
+// sends a call to the subscribed master
+func (d *HttpSchedulerDriver) call(call *v1Call) error {
+	d.mutex <- true
+	url, streamId := d.masterUrl, d.streamId
+	call.FrameworkId = newV1Value(d.frameworkId)
+	<-d.mutex
+
+	if url == "" {
+		return fmt.Errorf("Not subscribed with a master")
+	}
+	resp, err := d.post(url, call, streamId)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return newHttpApiError(resp)
+	}
+	return nil
+}
+
+func (d *HttpSchedulerDriver) post(url string, call *v1Call, streamId string) (*http.Response, error) {
+	body, err := json.Marshal(call)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if streamId != "" {
+		req.Header.Set("Mesos-Stream-Id", streamId)
+	}
+	return d.client.Do(req)
+}
+
+// sets the final status once and closes the event stream
+func (d *HttpSchedulerDriver) finish(status mesos.Status, err error) mesos.Status {
+	d.mutex <- true
+	defer func() { <-d.mutex }()
+
+	select {
+	case <-d.done:
+		return d.status
+	default:
+	}
+	d.status = status
+	if status == mesos.Status_DRIVER_ABORTED {
+		d.err = err
+	}
+	close(d.done)
+	if d.stream != nil {
+		d.stream.Close()
+	}
+	return d.status
+}
+
+func newHttpApiError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("Master responded with %s: %s", resp.Status, bytes.TrimSpace(body))
+}
+
+func newV1OfferIds(offerIds []*mesos.OfferID) []*v1Value {
+	ids := []*v1Value{}
+	for _, id := range offerIds {
+		ids = append(ids, &v1Value{Value: id.GetValue()})
+	}
+	return ids
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/stretchr/testify/assert"
+)
+
+// accepts calls and streams events to the subscribed scheduler
+type fakeMaster struct {
+	server *httptest.Server
+	calls  chan *v1Call
+	events chan *v1Event
+}
+
+func newFakeMaster() *fakeMaster {
+	m := &fakeMaster{
+		calls:  make(chan *v1Call, 100),
+		events: make(chan *v1Event, 100),
+	}
+	m.server = httptest.NewServer(http.HandlerFunc(m.handle))
+	return m
+}
+
+func (m *fakeMaster) handle(w http.ResponseWriter, r *http.Request) {
+	var call v1Call
+	if r.URL.Path != HTTP_API_PATH || json.NewDecoder(r.Body).Decode(&call) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	m.calls <- &call
+
+	if call.Type != "SUBSCRIBE" {
+		if r.Header.Get("Mesos-Stream-Id") != "stream-1" {
+			http.Error(w, "invalid stream id", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	w.Header().Set("Mesos-Stream-Id", "stream-1")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case e := <-m.events:
+			data, _ := json.Marshal(e)
+			WriteRecord(w, data)
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (m *fakeMaster) leader() string {
+	return strings.TrimPrefix(m.server.URL, "http://")
+}
+
+func (m *fakeMaster) expectCall(t *testing.T, callType string) *v1Call {
+	select {
+	case c := <-m.calls:
+		assert.Equal(t, callType, c.Type)
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Missing %s call", callType)
+		return nil
+	}
+}
+
+func newUpdateEvent(taskId, state string) *v1Event {
+	return &v1Event{Type: "UPDATE", Update: &v1Update{Status: &v1TaskStatus{
+		TaskId:  v1Value{Value: taskId},
+		State:   state,
+		AgentId: &v1Value{Value: "agent-1"},
+		Uuid:    []byte("uuid-" + state),
+	}}}
+}
+
+// tests
+
+func TestHttpSchedulerDriverRunsCommand(t *testing.T) {
+	m := newFakeMaster()
+	defer m.server.Close()
+
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	cq.Enqueue(&Command{Cmd: "foo", CpuReq: 1, MemReq: 128})
+	cq.Close()
+
+	fwinfo := &mesos.FrameworkInfo{User: proto.String("none"), Name: proto.String("NONE")}
+	d := NewHttpSchedulerDriver(s, fwinfo, NewStaticLeaderDetector(m.leader()))
+	result := make(chan mesos.Status, 1)
+	go func() {
+		status, err := d.Run()
+		assert.NoError(t, err)
+		result <- status
+	}()
+
+	subscribe := m.expectCall(t, "SUBSCRIBE")
+	assert.Equal(t, "NONE", subscribe.Subscribe.FrameworkInfo.Name)
+	assert.Nil(t, subscribe.FrameworkId)
+
+	m.events <- &v1Event{Type: "SUBSCRIBED", Subscribed: &v1Subscribed{FrameworkId: v1Value{Value: "framework-1"}, HeartbeatIntervalSeconds: 15}}
+	reconcile := m.expectCall(t, "RECONCILE")
+	assert.Equal(t, "framework-1", reconcile.FrameworkId.Value)
+	assert.Equal(t, 0, len(reconcile.Reconcile.Tasks))
+
+	m.events <- &v1Event{Type: "OFFERS", Offers: &v1Offers{Offers: []*v1Offer{{
+		Id:       v1Value{Value: "offer-1"},
+		AgentId:  v1Value{Value: "agent-1"},
+		Hostname: "host-1",
+		Resources: []*v1Resource{
+			{Name: "cpus", Type: "SCALAR", Scalar: &v1Scalar{Value: 1}},
+			{Name: "mem", Type: "SCALAR", Scalar: &v1Scalar{Value: 256}},
+		},
+	}}}}
+	accept := m.expectCall(t, "ACCEPT")
+	assert.Equal(t, "offer-1", accept.Accept.OfferIds[0].Value)
+	assert.Equal(t, "LAUNCH", accept.Accept.Operations[0].Type)
+	task := accept.Accept.Operations[0].Launch.TaskInfos[0]
+	assert.Equal(t, "1", task.TaskId.Value)
+	assert.Equal(t, "agent-1", task.AgentId.Value)
+	assert.Equal(t, "SCALAR", task.Resources[0].Type)
+
+	m.events <- newUpdateEvent("1", "TASK_RUNNING")
+	ack := m.expectCall(t, "ACKNOWLEDGE")
+	assert.Equal(t, "1", ack.Acknowledge.TaskId.Value)
+	assert.Equal(t, "agent-1", ack.Acknowledge.AgentId.Value)
+	assert.Equal(t, []byte("uuid-TASK_RUNNING"), ack.Acknowledge.Uuid)
+
+	m.events <- newUpdateEvent("1", "TASK_FINISHED")
+	m.expectCall(t, "TEARDOWN")
+	select {
+	case status := <-result:
+		assert.Equal(t, mesos.Status_DRIVER_STOPPED, status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Driver should have stopped")
+	}
+}
+
+func TestHttpSchedulerDriverAbortsOnError(t *testing.T) {
+	m := newFakeMaster()
+	defer m.server.Close()
+
+	s := newTestScheduler(NewCommandQueue(), NewRetryPolicy(0, 0, false))
+	d := NewHttpSchedulerDriver(s, &mesos.FrameworkInfo{}, NewStaticLeaderDetector(m.leader()))
+	_, err := d.Start()
+	assert.NoError(t, err)
+	m.expectCall(t, "SUBSCRIBE")
+
+	m.events <- &v1Event{Type: "ERROR", Error: &v1Error{Message: "Framework has been removed"}}
+	status, err := d.Join()
+	assert.Equal(t, mesos.Status_DRIVER_ABORTED, status)
+	assert.Error(t, err)
+}
+
+func TestHttpSchedulerDriverSubscribeFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Framework is not authorized", http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	d := NewHttpSchedulerDriver(nil, &mesos.FrameworkInfo{}, NewStaticLeaderDetector(strings.TrimPrefix(ts.URL, "http://")))
+	err := d.subscribe()
+	assert.EqualError(t, err, "Master responded with 403 Forbidden: Framework is not authorized")
+}
+
+func TestV1OfferConversion(t *testing.T) {
+	var o v1Offer
+	data := `{"id":{"value":"o1"},"framework_id":{"value":"f1"},"agent_id":{"value":"a1"},"hostname":"h1",
+		"resources":[{"name":"ports","type":"RANGES","ranges":{"range":[{"begin":31000,"end":31010}]},"role":"batch","reservation":{"principal":"none"}}],
+		"attributes":[{"name":"rack","type":"TEXT","text":{"value":"r1"}},{"name":"level","type":"SCALAR","scalar":{"value":2}}]}`
+	assert.NoError(t, json.Unmarshal([]byte(data), &o))
+
+	offer := o.toOffer()
+	assert.Equal(t, "a1", offer.GetSlaveId().GetValue())
+	assert.Equal(t, "h1", offer.GetHostname())
+	assert.Equal(t, mesos.Value_RANGES, offer.Resources[0].GetType())
+	assert.Equal(t, uint64(31010), offer.Resources[0].GetRanges().GetRange()[0].GetEnd())
+	assert.Equal(t, "batch", offer.Resources[0].GetRole())
+	assert.Equal(t, "none", offer.Resources[0].GetReservation().GetPrincipal())
+	assert.Equal(t, "r1", offer.Attributes[0].GetText().GetValue())
+	assert.Equal(t, 2.0, offer.Attributes[1].GetScalar().GetValue())
+}
+
+func TestV1ResourceRoundTrip(t *testing.T) {
+	data := `[{"name":"disk","type":"SCALAR","scalar":{"value":64},"role":"batch",` +
+		`"reservation":{"principal":"none","labels":{"labels":[{"key":"owner","value":"me"}]}},` +
+		`"disk":{"persistence":{"id":"data-1","principal":"none"},"volume":{"container_path":"data","mode":"RW"},` +
+		`"source":{"type":"PATH","path":{"root":"/mnt/disk1"}}}},` +
+		`{"name":"cpus","type":"SCALAR","scalar":{"value":1},"role":"*","revocable":{}}]`
+	var offered []*v1Resource
+	assert.NoError(t, json.Unmarshal([]byte(data), &offered))
+
+	disk := offered[0].toResource()
+	assert.Equal(t, "owner", disk.GetReservation().GetLabels().GetLabels()[0].GetKey())
+	assert.Equal(t, "data-1", disk.GetDisk().GetPersistence().GetId())
+	assert.Equal(t, "data", disk.GetDisk().GetVolume().GetContainerPath())
+	assert.Equal(t, "/mnt/disk1", disk.GetDisk().GetSource().GetPath().GetRoot())
+	assert.NotNil(t, offered[1].toResource().GetRevocable())
+
+	launched, err := json.Marshal([]*v1Resource{newV1Resource(disk), newV1Resource(offered[1].toResource())})
+	assert.NoError(t, err)
+	assert.JSONEq(t, data, string(launched), "resources should be launched as offered")
+}
+
+func TestV1TaskStatusConversion(t *testing.T) {
+	s := &v1TaskStatus{TaskId: v1Value{Value: "1"}, State: "TASK_LOST", Source: "SOURCE_AGENT", Reason: "REASON_AGENT_REMOVED"}
+	status := s.toTaskStatus()
+	assert.Equal(t, mesos.TaskState_TASK_LOST, status.GetState())
+	assert.Equal(t, mesos.TaskStatus_SOURCE_SLAVE, status.GetSource())
+	assert.Equal(t, mesos.TaskStatus_REASON_SLAVE_REMOVED, status.GetReason())
+	assert.True(t, IsInfrastructureFailure(status))
+}
+
+func TestV1TaskInfoConversion(t *testing.T) {
+	c := &Command{Id: "1", SlaveId: "a1", Cmd: "ls", CpuReq: 1, MemReq: 64, Env: map[string]string{"FOO": "bar"}, ContainerInfo: newDockerContainerInfo("busybox")}
+	s := newTestScheduler(NewCommandQueue(), NewRetryPolicy(0, 0, false))
+	task := newV1TaskInfo(s.prepareTaskInfo(newTestOffer("1", 1, 64), c))
+
+	data, err := json.Marshal(task)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"agent_id":{"value":"slave-1"}`)
+	assert.Contains(t, string(data), `"type":"DOCKER"`)
+	assert.Contains(t, string(data), `"image":"busybox"`)
+	assert.Contains(t, string(data), `{"name":"FOO","value":"bar"}`)
+}
+
+func TestV1ContainerInfoConversion(t *testing.T) {
+	ci := &mesos.ContainerInfo{
+		Type: mesos.ContainerInfo_DOCKER.Enum(),
+		Docker: &mesos.ContainerInfo_DockerInfo{
+			Image:   proto.String("busybox"),
+			Network: mesos.ContainerInfo_DockerInfo_BRIDGE.Enum(),
+			PortMappings: []*mesos.ContainerInfo_DockerInfo_PortMapping{
+				{HostPort: proto.Uint32(31000), ContainerPort: proto.Uint32(8080), Protocol: proto.String("tcp")},
+			},
+		},
+	}
+	data, err := json.Marshal(newV1ContainerInfo(ci))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"port_mappings":[{"host_port":31000,"container_port":8080,"protocol":"tcp"}]`)
+
+	ci = &mesos.ContainerInfo{
+		Type:  mesos.ContainerInfo_MESOS.Enum(),
+		Mesos: &mesos.ContainerInfo_MesosInfo{Image: &mesos.Image{Type: mesos.Image_DOCKER.Enum(), Docker: &mesos.Image_Docker{Name: proto.String("busybox")}}},
+	}
+	data, err = json.Marshal(newV1ContainerInfo(ci))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"MESOS","mesos":{"image":{"type":"DOCKER","docker":{"name":"busybox"}}}}`, string(data))
+}
@@ -7,18 +7,21 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
-	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
 	log "github.com/golang/glog"
-	archivex "github.com/jhoonb/archivex"
 	"github.com/mesos/mesos-go/auth"
 	"github.com/mesos/mesos-go/auth/sasl"
 	"github.com/mesos/mesos-go/auth/sasl/mech"
 	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
 	sched "github.com/mesos/mesos-go/scheduler"
 	"golang.org/x/net/context"
 )
@@ -28,7 +31,9 @@ const (
 	DEFAULT_MEM_PER_TASK  = 128
 	DEFAULT_ARTIFACT_PORT = 10080
 	DEFAULT_DRIVER_PORT   = 10050
-	WORKDIR_ARCHIVE       = "workdir.tar.gz"
+	DEFAULT_RETRY_BACKOFF = 5 * time.Second
+	// exit code after being interrupted, like shells do for SIGINT
+	EXIT_CODE_INTERRUPTED = 130
 )
 
 var (
@@ -38,6 +43,16 @@ var (
 	port               = flag.Uint("port", DEFAULT_DRIVER_PORT, "Binding port for framework")
 	artifactPort       = flag.Int("artifactPort", DEFAULT_ARTIFACT_PORT, "Binding port for artifact server")
 	master             = flag.String("master", "", "Master address <ip:port> or <zk://zk-url>")
+	httpApi            = flag.Bool("http-api", false, "Use the v1 HTTP scheduler API, the master does not need to connect back to NONE")
+	mesosHttps         = flag.Bool("mesos-https", false, "Connect to master and slave endpoints with https")
+	tlsCaFile          = flag.String("tls-ca-file", "", "PEM file with CA certificates for verifying masters and slaves")
+	tlsCertFile        = flag.String("tls-cert-file", "", "PEM file with a client certificate for masters and slaves")
+	tlsKeyFile         = flag.String("tls-key-file", "", "PEM file with the key of -tls-cert-file")
+	tlsInsecure        = flag.Bool("tls-insecure-skip-verify", false, "Don't verify certificates of masters and slaves")
+	artifactTls        = flag.Bool("artifact-tls", false, "Serve artifacts over https")
+	artifactCertFile   = flag.String("artifact-cert-file", "", "PEM file with the artifact server's certificate, a self-signed one is generated without")
+	artifactKeyFile    = flag.String("artifact-key-file", "", "PEM file with the key of -artifact-cert-file")
+	mesosAuthTokenFile = flag.String("mesos-authentication-token-file", "", "File with a bearer token for master and slave endpoints, overrules principal and secret")
 	authProvider       = flag.String("mesos-authentication-provider", sasl.ProviderName,
 		fmt.Sprintf("Authentication provider to use, default is SASL that supports mechanisms: %+v", mech.ListSupported()))
 	mesosAuthPrincipal  = flag.String("mesos-authentication-principal", "", "Mesos authentication principal.")
@@ -46,16 +61,44 @@ var (
 	role                = flag.String("role", "*", "Run tasks with resources for specific role.")
 	framworkName        = flag.String("framework-name", "NONE", "Framework name")
 	sendWorkdir         = flag.Bool("send-workdir", true, "Send current working dir to executor.")
+	workdirCache        = flag.String("workdir-cache", DefaultWorkdirCache(), "Directory for keeping workdir archives, unchanged workdirs are not archived again")
 	cpuPerTask          = flag.Float64("cpu-per-task", DEFAULT_CPUS_PER_TASK, "CPU reservation for task execution")
 	memPerTask          = flag.Float64("mem-per-task", DEFAULT_MEM_PER_TASK, "Memory resveration for task execution")
+	diskPerTask         = flag.Float64("disk-per-task", 0, "Disk reservation for task execution")
+	portsPerTask        = flag.Int("ports-per-task", 0, "Number of ports for task execution, passed to the command as $PORT0..N")
+	resourcesPerTask    = flag.String("resources-per-task", "", "Additional scalar resources for task execution <name:value[;..]>")
 	command             = flag.String("command", "", "Command to run on the cluster")
+	inputFormat         = flag.String("input-format", INPUT_FORMAT_PLAIN, "Format of commands read from stdin: <plain|json>")
+	maxRetries          = flag.Int("max-retries", 0, "Number of retries for lost tasks")
+	retryBackoff        = flag.Duration("retry-backoff", DEFAULT_RETRY_BACKOFF, "Delay before the first retry, doubled with each further retry")
+	retryFailed         = flag.Bool("retry-failed", false, "Retry commands exiting with non-zero status, too")
+	taskTimeout         = flag.Duration("task-timeout", 0, "Kill tasks running longer than this, e.g. 30m")
+	reconcileInterval   = flag.Duration("reconcile-interval", DEFAULT_RECONCILE_INTERVAL, "Interval for reconciling task states with the master")
+	stateFile           = flag.String("state-file", "", "Save the state of the run to this file for resuming it with -resume")
+	resume              = flag.String("resume", "", "Resume the run saved in this state file")
+	stateZk             = flag.String("state-zk", "", "Save the state of the run in Zookeeper <zk://host:port/path>, instances sharing the path take over from each other")
+	failoverTimeout     = flag.Duration("failover-timeout", DEFAULT_FAILOVER_TIMEOUT, "Time for resuming a run before Mesos kills its tasks, used with -state-file and -state-zk")
+	exitCodeMode        = flag.String("exit-code", EXIT_CODE_MODE_MAX, "Exit code aggregation of failed commands: <max|first-failure|count>")
 	containerJson       = flag.String("container", "", "Container definition as JSON, overrules dockerImage")
 	dockerImage         = flag.String("docker-image", "", "Docker image for running the commands in")
 	constraints         = flag.String("constraints", "", "Constraints for selecting mesos slaves <attribute:operant[:value][;..]>")
+	placement           = flag.String("placement", PLACEMENT_FIRST_FIT, "Strategy for placing tasks on offers: <first-fit|best-fit|spread>")
+	placementLookahead  = flag.Int("placement-lookahead", 1, "Number of queued commands considered for each placement, later commands may skip ahead of ones not fitting any offer")
+	outputMode          = flag.String("output-mode", OUTPUT_MODE_STREAM, "Output of the tasks: <stream|grouped>, grouped prints each task's output after it ended")
+	outputPrefix        = flag.Bool("output-prefix", false, "Prefix each line of output with [task-id|hostname]")
+	outputColor         = flag.Bool("output-color", true, "Color the prefix of each task when writing to a terminal")
+	outputDir           = flag.String("output-dir", "", "Save each task's output to <task-id>.stdout and .stderr in this directory instead of printing it")
+	fetchArtifacts      = flag.String("fetch-artifacts", "", "Download files matching this glob from the sandbox of finished tasks, e.g. 'target/*.jar'")
+	artifactsDir        = flag.String("artifacts-dir", DEFAULT_ARTIFACTS_DIR, "Directory for artifacts downloaded with -fetch-artifacts, one subdirectory per task")
 	version             = flag.Bool("version", false, "Show NONE version.")
 
 	containerInfo *mesos.ContainerInfo
+	taskResources map[string]float64
 	uris          []*mesos.CommandInfo_URI
+	// tracks the current master for looking up task sandboxes
+	leaderDetector LeaderDetector = NewStaticLeaderDetector("")
+	// writes the output of all tasks
+	output = NewOutput(os.Stdout, os.Stderr, OUTPUT_MODE_STREAM, false, false, false)
 )
 
 // parse command line flags
@@ -68,60 +111,161 @@ func init() {
 	runtime.GOMAXPROCS(numThreads)
 }
 
-// returns uri pointing to artifact
-func serveArtifact(path, base string) *string {
-	serveFile := func(pattern string, filename string) {
-		http.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
-			http.ServeFile(w, r, filename)
-		})
+// tar workdir, skipping files ignored by .gitignore and .noneignore
+// returns path to local artifact
+func tarWorkdir() (*string, error) {
+	if !*sendWorkdir {
+		return nil, nil
 	}
 
-	serveFile("/"+base, path)
-
-	hostURI := fmt.Sprintf("http://%s:%d/%s", *address, *artifactPort, base)
-	log.Infof("Hosting artifact '%s' at '%s'", path, hostURI)
-
-	return &hostURI
+	path, err := ArchiveWorkdir(".", *workdirCache)
+	if err != nil {
+		return nil, err
+	}
+	return &path, nil
 }
 
-// tar workdir
-// returns path to local artifact
-func tarWorkdir() *string {
-	if !*sendWorkdir {
+// prepare the http client for masters and slaves
+// requests are authenticated like the framework, or with a token
+func prepareHttpClient(cred *mesos.Credential) error {
+	if *mesosHttps {
+		mesosScheme = "https"
+	}
+	var credentials *HttpCredentials
+	if *mesosAuthTokenFile != "" {
+		token, err := ioutil.ReadFile(*mesosAuthTokenFile)
+		if err != nil {
+			return err
+		}
+		credentials = &HttpCredentials{Token: strings.TrimSpace(string(token))}
+	} else if cred != nil {
+		credentials = &HttpCredentials{Principal: cred.GetPrincipal(), Secret: strings.TrimSpace(string(cred.GetSecret()))}
+	}
+	if *tlsCaFile == "" && *tlsCertFile == "" && !*tlsInsecure && credentials == nil {
 		return nil
 	}
-
-	path := fmt.Sprintf("%s/none-workdir-%d.tar.gz", os.TempDir(), os.Getpid())
-	tar := new(archivex.TarFile)
-	tar.Create(path)
-	tar.AddAll(".", true)
-	tar.Close()
-	return &path
+	config, err := NewClientTLSConfig(*tlsCaFile, *tlsCertFile, *tlsKeyFile, *tlsInsecure)
+	if err != nil {
+		return err
+	}
+	httpClient = NewHttpClient(config, credentials)
+	return nil
 }
 
-// server workdir and executor artifacts
-// returns (executor command, artifact uris)
-func exportArtifacts(workdirPath *string) []*mesos.CommandInfo_URI {
+// serve workdir and executor artifacts
+// returns (artifact server, artifact uris), the server is nil without any artifacts
+func exportArtifacts(workdirPath *string) (*ArtifactServer, []*mesos.CommandInfo_URI, error) {
 	executorUris := []*mesos.CommandInfo_URI{}
-	if workdirPath != nil {
-		uri := serveArtifact(*workdirPath, WORKDIR_ARCHIVE)
-		executorUris = append(executorUris, &mesos.CommandInfo_URI{Value: uri, Executable: proto.Bool(false)})
+	if workdirPath == nil {
+		return nil, executorUris, nil
 	}
 
-	go http.ListenAndServe(fmt.Sprintf("%s:%d", *address, *artifactPort), nil)
+	// the secret is kept with the archives, urls of unchanged archives stay the same across runs
+	secret, err := LoadArtifactSecret(filepath.Join(*workdirCache, ARTIFACT_SECRET_FILE))
+	if err != nil {
+		return nil, nil, err
+	}
+	server, err := NewArtifactServer(*address, *artifactPort, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	if *artifactTls {
+		if err := server.EnableTLS(*artifactCertFile, *artifactKeyFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	// the archive's name changes with its content, so slaves may cache it
+	uri := server.Serve(*workdirPath, filepath.Base(*workdirPath))
+	executorUris = append(executorUris, &mesos.CommandInfo_URI{Value: &uri, Executable: proto.Bool(false), Cache: proto.Bool(true)})
+
+	if err := server.Start(); err != nil {
+		return nil, nil, err
+	}
 	log.Infoln("Serving executor artifacts...")
 
-	return executorUris
+	return server, executorUris, nil
 }
 
 // create the framework data structure
-func prepareFrameworkInfo() *mesos.FrameworkInfo {
-	return &mesos.FrameworkInfo{
+// a framework saving its state keeps its tasks running for failoverTimeout after the scheduler died
+func prepareFrameworkInfo(store StateStore, frameworkId string) *mesos.FrameworkInfo {
+	fwinfo := &mesos.FrameworkInfo{
 		User:     proto.String(*user),
 		Name:     proto.String(*framworkName),
 		Hostname: proto.String(*hostname),
 		Role:     proto.String(*role),
 	}
+	if store != nil {
+		fwinfo.FailoverTimeout = proto.Float64(failoverTimeout.Seconds())
+		fwinfo.Checkpoint = proto.Bool(true)
+	}
+	if frameworkId != "" {
+		fwinfo.Id = util.NewFrameworkID(frameworkId)
+	}
+	return fwinfo
+}
+
+// returns the store to save the run to and the state to resume, both may be nil
+func prepareState() (StateStore, *State, error) {
+	if *stateZk != "" {
+		return prepareZkState()
+	}
+	if *resume != "" {
+		store := NewStateFile(*resume)
+		state, err := store.Load()
+		if err != nil {
+			return nil, nil, err
+		}
+		if state == nil {
+			return nil, nil, fmt.Errorf("No state saved in %s", *resume)
+		}
+		return store, state, nil
+	}
+	if *stateFile != "" {
+		return NewStateFile(*stateFile), nil, nil
+	}
+	return nil, nil, nil
+}
+
+// waits for becoming the leader of all instances sharing the zookeeper path
+// the leader resumes the saved run, if any
+func prepareZkState() (StateStore, *State, error) {
+	conn, path, err := ConnectZk(*stateZk)
+	if err != nil {
+		return nil, nil, err
+	}
+	election := NewZkLeaderElection(conn, path, fmt.Sprintf("%s:%d", *address, *port))
+	log.Infoln("Waiting for leadership in", *stateZk)
+	if err := election.Elect(); err != nil {
+		return nil, nil, err
+	}
+	election.Watch(func() {
+		// exit without stopping the framework, the new leader resumes the run
+		log.Errorln("Lost leadership in", *stateZk, ", exiting")
+		os.Exit(2)
+	})
+
+	store := NewZkStateStore(conn, path)
+	state, err := store.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, state, nil
+}
+
+// queue the commands of a resumed run
+func resumeCommands(scheduler *NoneScheduler, cmdq *CommandQueue, state *State) error {
+	commands, err := state.GetCommands()
+	if err != nil {
+		return err
+	}
+	for _, c := range commands {
+		c.Uris = uris
+	}
+	log.Infoln("Resuming", len(commands), "commands of framework", state.FrameworkId)
+	scheduler.Restore(state.FrameworkId, commands)
+	cmdq.Close()
+	return nil
 }
 
 // create credentials data structure
@@ -149,12 +293,7 @@ func prepareContainer() *mesos.ContainerInfo {
 		}
 		return &ci
 	} else if dockerImage != nil && *dockerImage != "" {
-		return &mesos.ContainerInfo{
-			Type: mesos.ContainerInfo_DOCKER.Enum(),
-			Docker: &mesos.ContainerInfo_DockerInfo{
-				Image: dockerImage,
-			},
-		}
+		return newDockerContainerInfo(*dockerImage)
 	}
 	return nil
 }
@@ -166,17 +305,23 @@ func prepareResourceFilter(cs Constraints) *ResourceFilter {
 	}
 }
 
+func prepareLeaderDetector() LeaderDetector {
+	if strings.HasPrefix(*master, "zk://") {
+		return NewZkLeaderDetector()
+	}
+	return NewStaticLeaderDetector(*master)
+}
+
 // create the driver data structure
 func prepareDriver(scheduler sched.Scheduler, ld LeaderDetector, fwinfo *mesos.FrameworkInfo, cred *mesos.Credential) (sched.DriverConfig, error) {
 	if len(*master) == 0 {
 		return sched.DriverConfig{}, fmt.Errorf("--master is a mandatory flag.")
 	}
 	if strings.HasPrefix(*master, "zk://") {
-		m, err := ld.Detect(master)
-		if err != nil {
+		// wait for the first leader, the driver follows leader changes on its own
+		if _, err := ld.Detect(master); err != nil {
 			return sched.DriverConfig{}, err
 		}
-		master = m
 	}
 	bindingAddress := parseIP(*address)
 	return sched.DriverConfig{
@@ -195,6 +340,30 @@ func prepareDriver(scheduler sched.Scheduler, ld LeaderDetector, fwinfo *mesos.F
 	}, nil
 }
 
+// create a driver for the v1 HTTP API, following the leading master
+func prepareHttpDriver(scheduler sched.Scheduler, ld LeaderDetector, fwinfo *mesos.FrameworkInfo) (*HttpSchedulerDriver, error) {
+	if len(*master) == 0 {
+		return nil, fmt.Errorf("--master is a mandatory flag.")
+	}
+	if strings.HasPrefix(*master, "zk://") {
+		if _, err := ld.Detect(master); err != nil {
+			return nil, err
+		}
+	}
+	return NewHttpSchedulerDriver(scheduler, fwinfo, ld), nil
+}
+
+func prepareSchedulerDriver(scheduler sched.Scheduler, ld LeaderDetector, fwinfo *mesos.FrameworkInfo, cred *mesos.Credential) (sched.SchedulerDriver, error) {
+	if *httpApi {
+		return prepareHttpDriver(scheduler, ld, fwinfo)
+	}
+	config, err := prepareDriver(scheduler, ld, fwinfo, cred)
+	if err != nil {
+		return nil, err
+	}
+	return sched.NewMesosSchedulerDriver(config)
+}
+
 // resolve hostname to ip
 func parseIP(address string) net.IP {
 	addr, err := net.LookupIP(address)
@@ -207,27 +376,69 @@ func parseIP(address string) net.IP {
 	return addr[0]
 }
 
-func startCommand(cmdq *CommandQueue, cmd *string) {
-	cmdq.Enqueue(&Command{
-		Cmd:           *cmd,
+// checks the default resources of each task given by command line flags
+func checkTaskResources() error {
+	if *cpuPerTask < 0 || *memPerTask < 0 || *diskPerTask < 0 {
+		return fmt.Errorf("Invalid resources per task: cpus %v, mem %v, disk %v", *cpuPerTask, *memPerTask, *diskPerTask)
+	}
+	if *portsPerTask < 0 {
+		return fmt.Errorf("Invalid number of ports per task: %d", *portsPerTask)
+	}
+	return nil
+}
+
+// create command with defaults from command line flags
+func newCommand(cmd string) *Command {
+	return &Command{
+		Cmd:           cmd,
 		CpuReq:        *cpuPerTask,
 		MemReq:        *memPerTask,
+		DiskReq:       *diskPerTask,
+		Resources:     taskResources,
+		Ports:         *portsPerTask,
+		Timeout:       *taskTimeout,
 		ContainerInfo: containerInfo,
 		Uris:          uris,
-	})
+	}
+}
+
+func startCommand(cmdq *CommandQueue, cmd *string) {
+	cmdq.Enqueue(newCommand(*cmd))
 }
 
-func startCommands(cmdq *CommandQueue) {
+// queue command from a JSON line
+func startCommandSpec(cmdq *CommandQueue, line string) error {
+	spec, err := ParseCommandSpec(line)
+	if err != nil {
+		return err
+	}
+	c := newCommand("")
+	if err := spec.Apply(c); err != nil {
+		return err
+	}
+	cmdq.Enqueue(c)
+	return nil
+}
+
+func startCommands(cmdq *CommandQueue, handler *CommandHandler) {
 	reader := bufio.NewReader(os.Stdin)
 	cmd, err := reader.ReadString('\n')
 	for err == nil {
-		startCommand(cmdq, &cmd)
+		if *inputFormat == INPUT_FORMAT_JSON {
+			if strings.TrimSpace(cmd) != "" {
+				if err := startCommandSpec(cmdq, cmd); err != nil {
+					handler.CommandInvalid(strings.TrimSpace(cmd), err)
+				}
+			}
+		} else {
+			startCommand(cmdq, &cmd)
+		}
 		cmd, err = reader.ReadString('\n')
 	}
 	cmdq.Close()
 }
 
-func queueCommands(cmdq *CommandQueue) {
+func queueCommands(cmdq *CommandQueue, handler *CommandHandler) {
 	if command != nil && *command != "" {
 		// queue single command for execution
 		startCommand(cmdq, command)
@@ -235,10 +446,26 @@ func queueCommands(cmdq *CommandQueue) {
 	} else {
 		// queue commands from stdin for execution
 		// non-blocking
-		go startCommands(cmdq)
+		go startCommands(cmdq, handler)
 	}
 }
 
+// kill all tasks on first interrupt, exit immediately on second interrupt
+func handleSignals(scheduler *NoneScheduler, driver sched.SchedulerDriver) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Infoln("Interrupted, killing all tasks")
+		fmt.Fprintln(os.Stderr, "NONE: interrupted, killing all tasks. Interrupt again to exit immediately.")
+		scheduler.Shutdown(driver)
+
+		<-signals
+		log.Infoln("Interrupted again, exiting")
+		os.Exit(EXIT_CODE_INTERRUPTED)
+	}()
+}
+
 // ----------------------- func main() ------------------------- //
 
 func main() {
@@ -247,12 +474,52 @@ func main() {
 		os.Exit(0)
 	}
 
-	workdirPath := tarWorkdir()
-	if workdirPath != nil {
-		defer os.Remove(*workdirPath)
+	if *inputFormat != INPUT_FORMAT_PLAIN && *inputFormat != INPUT_FORMAT_JSON {
+		log.Errorln("Unsupported input format:", *inputFormat)
+		os.Exit(10)
+	}
+
+	if !IsValidExitCodeMode(*exitCodeMode) {
+		log.Errorln("Unsupported exit code mode:", *exitCodeMode)
+		os.Exit(10)
+	}
+
+	if err := checkTaskResources(); err != nil {
+		log.Errorln(err)
+		os.Exit(10)
+	}
+	if !IsValidOutputMode(*outputMode) {
+		log.Errorln("Unsupported output mode:", *outputMode)
+		os.Exit(10)
 	}
-	uris = exportArtifacts(workdirPath)
+	if *outputDir != "" {
+		o, err := NewDirOutput(*outputDir)
+		if err != nil {
+			log.Errorln("Unable to prepare output directory:", err)
+			os.Exit(10)
+		}
+		output = o
+	} else {
+		output = NewOutput(os.Stdout, os.Stderr, *outputMode, *outputPrefix,
+			*outputColor && IsTerminal(os.Stdout), *outputColor && IsTerminal(os.Stderr))
+	}
+
+	workdirPath, err := tarWorkdir()
+	if err != nil {
+		log.Errorln("Unable to archive workdir:", err)
+		os.Exit(10)
+	}
+	artifactServer, artifactUris, err := exportArtifacts(workdirPath)
+	if err != nil {
+		log.Errorln(err)
+		os.Exit(10)
+	}
+	uris = artifactUris
 	containerInfo = prepareContainer()
+	if taskResources, err = ParseScalarResources(*resourcesPerTask); err != nil {
+		log.Errorln(err)
+		os.Exit(10)
+	}
 
 	cmdq := NewCommandQueue()
 	cs, err := ParseConstraints(constraints)
@@ -261,31 +528,83 @@ func main() {
 		os.Exit(10)
 	}
 	handler := NewCommandHandler()
-	scheduler := NewNoneScheduler(cmdq, handler, prepareResourceFilter(cs))
+	if *fetchArtifacts != "" {
+		if handler.Artifacts, err = NewArtifactFetcher(*fetchArtifacts, *artifactsDir); err != nil {
+			log.Errorln(err)
+			os.Exit(10)
+		}
+	}
+	retry := NewRetryPolicy(*maxRetries, *retryBackoff, *retryFailed)
+	scheduler := NewNoneScheduler(cmdq, handler, prepareResourceFilter(cs), retry, NewReconciler(*reconcileInterval))
+	p, err := NewPlacement(*placement)
+	if err != nil {
+		log.Errorln(err)
+		os.Exit(10)
+	}
+	if *placementLookahead < 1 {
+		log.Errorln("Invalid placement lookahead:", *placementLookahead)
+		os.Exit(10)
+	}
+	scheduler.SetPlacement(p, *placementLookahead)
 
-	fwinfo := prepareFrameworkInfo()
-	cred := prepateCredentials(fwinfo)
-	config, err := prepareDriver(scheduler, NewZkLeaderDetector(), fwinfo, cred)
+	store, state, err := prepareState()
 	if err != nil {
-		log.Errorln("Unable to create a mesos driver:", err.Error())
+		log.Errorln("Unable to load state:", err)
 		os.Exit(10)
 	}
+	if state != nil && state.Complete {
+		log.Infoln("The run is already complete")
+		return
+	}
+	frameworkId := ""
+	if state != nil {
+		if err := resumeCommands(scheduler, cmdq, state); err != nil {
+			log.Errorln("Unable to resume commands:", err)
+			os.Exit(10)
+		}
+		frameworkId = state.FrameworkId
+	}
 
-	driver, err := sched.NewMesosSchedulerDriver(config)
+	fwinfo := prepareFrameworkInfo(store, frameworkId)
+	cred := prepateCredentials(fwinfo)
+	if err := prepareHttpClient(cred); err != nil {
+		log.Errorln("Unable to prepare http client:", err)
+		os.Exit(10)
+	}
+	leaderDetector = prepareLeaderDetector()
+	driver, err := prepareSchedulerDriver(scheduler, leaderDetector, fwinfo, cred)
 	if err != nil {
 		log.Errorln("Unable to create a SchedulerDriver:", err.Error())
 		os.Exit(10)
 	}
 
-	queueCommands(cmdq)
+	handleSignals(scheduler, driver)
+	if artifactServer != nil {
+		scheduler.SetArtifactServer(artifactServer)
+	}
+	scheduler.StartReconciliation(driver, *reconcileInterval)
+	if store != nil {
+		scheduler.StartCheckpointing(store, STATE_CHECKPOINT_INTERVAL)
+	}
+	if state == nil {
+		queueCommands(cmdq, handler)
+	}
 
 	// run the driver and wait for it to finish
 	if stat, err := driver.Run(); err != nil {
 		log.Infof("Framework stopped with status %s and error: %s\n", stat.String(), err.Error())
 		os.Exit(2)
 	}
+	if store != nil {
+		if err := store.Complete(); err != nil {
+			log.Errorln("Unable to complete state:", err)
+		}
+	}
 
-	if handler.HasFailures() {
-		os.Exit(1)
+	if scheduler.IsShutdown() {
+		os.Exit(EXIT_CODE_INTERRUPTED)
+	}
+	if code := handler.ExitCode(*exitCodeMode); code != 0 {
+		os.Exit(code)
 	}
 }
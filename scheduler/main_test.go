@@ -73,6 +73,16 @@ func TestPrepareDriverStaticMaster(t *testing.T) {
 	m.AssertNotCalled(t, "Detector")
 }
 
+func TestPrepareLeaderDetector(t *testing.T) {
+	leader := "1.2.3.4:5050"
+	master = &leader
+	assert.Equal(t, "1.2.3.4:5050", prepareLeaderDetector().Leader())
+
+	zkUrl := "zk://foo:2181/mesos"
+	master = &zkUrl
+	assert.IsType(t, &ZkLeaderDetector{}, prepareLeaderDetector())
+}
+
 func TestPrepareDriverZkMaster(t *testing.T) {
 	zkUrl := "zk://foo:2181/mesos"
 	master = &zkUrl
@@ -84,6 +94,28 @@ func TestPrepareDriverZkMaster(t *testing.T) {
 	d, err := prepareDriver(nil, m, nil, nil)
 	assert.Nil(t, err)
 	assert.NotNil(t, d)
-	assert.Equal(t, d.Master, "1.2.3.4:5050")
+	assert.Equal(t, d.Master, zkUrl, "driver should follow leader changes")
+	assert.Equal(t, "zk://foo:2181/mesos", *master, "master flag should not be rewritten")
 	m.AssertExpectations(t)
 }
+
+func TestCheckTaskResources(t *testing.T) {
+	cpus, mem, disk, ports := *cpuPerTask, *memPerTask, *diskPerTask, *portsPerTask
+	defer func() { *cpuPerTask, *memPerTask, *diskPerTask, *portsPerTask = cpus, mem, disk, ports }()
+	assert.Nil(t, checkTaskResources())
+
+	*cpuPerTask = -1
+	assert.NotNil(t, checkTaskResources())
+	*cpuPerTask = cpus
+
+	*memPerTask = -1
+	assert.NotNil(t, checkTaskResources())
+	*memPerTask = mem
+
+	*diskPerTask = -1
+	assert.NotNil(t, checkTaskResources())
+	*diskPerTask = disk
+
+	*portsPerTask = -1
+	assert.NotNil(t, checkTaskResources())
+}
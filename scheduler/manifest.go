@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const MANIFEST_FILE = "manifest.json"
+
+// records the tasks whose output was saved to a directory
+type Manifest struct {
+	Path  string
+	Tasks []*ManifestEntry
+	mutex chan bool
+}
+
+type ManifestEntry struct {
+	TaskId   string     `json:"task_id"`
+	Cmd      string     `json:"cmd"`
+	Hostname string     `json:"hostname"`
+	State    string     `json:"state"`
+	ExitCode int        `json:"exit_code"`
+	Started  *time.Time `json:"started,omitempty"`
+	Ended    *time.Time `json:"ended,omitempty"`
+}
+
+// loads the manifest in dir, a resumed run continues it
+func NewManifest(dir string) (*Manifest, error) {
+	m := &Manifest{
+		Path:  filepath.Join(dir, MANIFEST_FILE),
+		Tasks: []*ManifestEntry{},
+		mutex: make(chan bool, 1),
+	}
+	data, err := ioutil.ReadFile(m.Path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.Tasks); err != nil {
+		return nil, fmt.Errorf("Invalid manifest %s: %s", m.Path, err)
+	}
+	return m, nil
+}
+
+// records the current state of the command's task and saves the manifest
+func (m *Manifest) Record(c *Command) error {
+	m.mutex <- true
+	defer func() { <-m.mutex }()
+
+	e := m.entry(c.Id)
+	e.Cmd = c.Cmd
+	e.Hostname = c.Hostname
+	e.State = c.Status.GetState().String()
+	e.ExitCode = c.ExitCode
+	now := time.Now()
+	if e.Started == nil {
+		e.Started = &now
+	}
+	if c.HasEnded() && e.Ended == nil {
+		e.Ended = &now
+	}
+	return m.save()
+}
+
+// private
+
+func (m *Manifest) entry(id string) *ManifestEntry {
+	for _, e := range m.Tasks {
+		if e.TaskId == id {
+			return e
+		}
+	}
+	e := &ManifestEntry{TaskId: id}
+	m.Tasks = append(m.Tasks, e)
+	return e
+}
+
+// writes a temporary file first, like StateFile
+func (m *Manifest) save() error {
+	data, err := json.MarshalIndent(m.Tasks, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.Path)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestRecordsTasks(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "none-manifest")
+	defer os.RemoveAll(dir)
+
+	m, err := NewManifest(dir)
+	assert.Nil(t, err)
+
+	c := &Command{Id: "1", Cmd: "echo foo", Hostname: "slave-1"}
+	c.Status = util.NewTaskStatus(util.NewTaskID("1"), mesos.TaskState_TASK_RUNNING)
+	assert.Nil(t, m.Record(c))
+	assert.NotNil(t, m.Tasks[0].Started)
+	assert.Nil(t, m.Tasks[0].Ended)
+
+	c.Status = util.NewTaskStatus(util.NewTaskID("1"), mesos.TaskState_TASK_FAILED)
+	c.ExitCode = 3
+	assert.Nil(t, m.Record(c))
+
+	// a resumed run continues the manifest
+	m, err = NewManifest(dir)
+	assert.Nil(t, err)
+	assert.Len(t, m.Tasks, 1)
+	e := m.Tasks[0]
+	assert.Equal(t, "1", e.TaskId)
+	assert.Equal(t, "echo foo", e.Cmd)
+	assert.Equal(t, "slave-1", e.Hostname)
+	assert.Equal(t, "TASK_FAILED", e.State)
+	assert.Equal(t, 3, e.ExitCode)
+	assert.NotNil(t, e.Started)
+	assert.NotNil(t, e.Ended)
+}
+
+func TestInvalidManifest(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "none-manifest")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(dir+"/"+MANIFEST_FILE, []byte("foo"), 0644)
+
+	_, err := NewManifest(dir)
+	assert.NotNil(t, err)
+}
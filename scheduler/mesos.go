@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"strings"
 )
 
@@ -25,12 +24,14 @@ func NewMasterState(r io.Reader) (*MasterState, error) {
 }
 
 func FetchMasterState(master *string) (*MasterState, error) {
-	url := fmt.Sprintf("http://%s/master/state.json", *master)
-	resp, err := http.Get(url)
+	resp, err := httpClient.Get(mesosUrl(*master, "/master/state.json"))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
 	return NewMasterState(resp.Body)
 }
 
@@ -56,7 +57,7 @@ func (s *Slave) GetPort() string {
 }
 
 func (s *Slave) GetUrl() string {
-	return fmt.Sprintf("http://%s:%s", *s.Hostname, s.GetPort())
+	return mesosUrl(*s.Hostname+":"+s.GetPort(), "")
 }
 
 func (s *Slave) GetStateUrl() string {
@@ -65,21 +66,25 @@ func (s *Slave) GetStateUrl() string {
 }
 
 func (s *Slave) GetState() (*SlaveState, error) {
-	resp, err := http.Get(s.GetStateUrl())
+	resp, err := httpClient.Get(s.GetStateUrl())
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
 	return NewSlaveState(resp.Body)
 }
 
 // ------ slave state --- //
 
 type SlaveState struct {
-	Id         *string
-	Pid        *string
-	Hostname   *string
-	Frameworks []*Framework
+	Id                  *string
+	Pid                 *string
+	Hostname            *string
+	Frameworks          []*Framework
+	CompletedFrameworks []*Framework `json:"completed_frameworks"`
 }
 
 func NewSlaveState(r io.Reader) (*SlaveState, error) {
@@ -98,6 +103,11 @@ func (s *SlaveState) GetFramework(id string) *Framework {
 			return f
 		}
 	}
+	for _, f := range s.CompletedFrameworks {
+		if *f.Id == id {
+			return f
+		}
+	}
 	return nil
 }
 
@@ -118,17 +128,24 @@ func (s *SlaveState) GetDirectory(frameworkId, taskId string) *string {
 // ------ framework --- //
 
 type Framework struct {
-	Id        *string
-	Container *string
-	Executors []*Executor
+	Id                 *string
+	Container          *string
+	Executors          []*Executor
+	CompletedExecutors []*Executor `json:"completed_executors"`
 }
 
+// finds running and completed executors
 func (f *Framework) GetExecutor(id string) *Executor {
 	for _, e := range f.Executors {
 		if *e.Id == id {
 			return e
 		}
 	}
+	for _, e := range f.CompletedExecutors {
+		if *e.Id == id {
+			return e
+		}
+	}
 	return nil
 }
 
@@ -64,3 +64,15 @@ func TestGetDirectory(t *testing.T) {
 	assert.NotNil(t, v, "Directory not found")
 	assert.Equal(t, d, *v, "Directory mismatch")
 }
+
+func TestGetCompletedExecutor(t *testing.T) {
+	id := "1"
+	dir := "/sandbox"
+	f := &Framework{
+		Executors:          []*Executor{},
+		CompletedExecutors: []*Executor{&Executor{Id: &id, Directory: &dir}},
+	}
+
+	assert.NotNil(t, f.GetExecutor("1"), "Completed executor not found")
+	assert.Nil(t, f.GetExecutor("2"))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/golang/glog"
+)
+
+const (
+	// print output line by line as soon as it is streamed
+	OUTPUT_MODE_STREAM = "stream"
+	// print the complete output of each task after it ended
+	OUTPUT_MODE_GROUPED = "grouped"
+
+	ANSI_RESET = "\x1b[0m"
+)
+
+// colors assigned to tasks in turn
+var ansiColors = []string{"\x1b[32m", "\x1b[33m", "\x1b[34m", "\x1b[35m", "\x1b[36m", "\x1b[31m"}
+
+// writes the output of all tasks to stdout and stderr
+// lines of different tasks never mix
+// with Dir set, each task's output is saved to its own files instead
+type Output struct {
+	Mode        string
+	Prefix      bool
+	StdoutColor bool
+	StderrColor bool
+	Dir         string
+	stdout      io.Writer
+	stderr      io.Writer
+	manifest    *Manifest
+	mutex       chan bool
+	tasks       int
+}
+
+// a writer for one stream of a single task
+type TaskWriter struct {
+	output *Output
+	w      io.Writer
+	prefix string
+	buf    string
+}
+
+// prefixes are colored separately on stdout and stderr, e.g. only on the one writing to a terminal
+func NewOutput(stdout, stderr io.Writer, mode string, prefix, stdoutColor, stderrColor bool) *Output {
+	return &Output{
+		Mode:        mode,
+		Prefix:      prefix,
+		StdoutColor: stdoutColor,
+		StderrColor: stderrColor,
+		stdout:      stdout,
+		stderr:      stderr,
+		mutex:       make(chan bool, 1),
+	}
+}
+
+// saves the output of each task to <dir>/<task-id>.stdout and .stderr
+func NewDirOutput(dir string) (*Output, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	m, err := NewManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Output{
+		Mode:     OUTPUT_MODE_STREAM,
+		Dir:      dir,
+		manifest: m,
+		mutex:    make(chan bool, 1),
+	}, nil
+}
+
+func IsValidOutputMode(mode string) bool {
+	return mode == OUTPUT_MODE_STREAM || mode == OUTPUT_MODE_GROUPED
+}
+
+// checks if f is a terminal and understands colors
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// returns writers for stdout and stderr of the command's task
+func (o *Output) Writers(c *Command) (StringWriter, StringWriter, error) {
+	if o.Dir != "" {
+		return o.fileWriters(c)
+	}
+
+	o.mutex <- true
+	defer func() { <-o.mutex }()
+
+	stdoutPrefix, stderrPrefix := "", ""
+	if o.Prefix {
+		prefix := fmt.Sprintf("[%s|%s] ", c.Id, c.Hostname)
+		colored := ansiColors[o.tasks%len(ansiColors)] + prefix + ANSI_RESET
+		stdoutPrefix, stderrPrefix = prefix, prefix
+		if o.StdoutColor {
+			stdoutPrefix = colored
+		}
+		if o.StderrColor {
+			stderrPrefix = colored
+		}
+	}
+	o.tasks++
+	return &TaskWriter{output: o, w: o.stdout, prefix: stdoutPrefix},
+		&TaskWriter{output: o, w: o.stderr, prefix: stderrPrefix}, nil
+}
+
+// records the command's task in the manifest of Dir
+func (o *Output) Record(c *Command) {
+	if o.manifest == nil {
+		return
+	}
+	if err := o.manifest.Record(c); err != nil {
+		log.Errorf("Unable to record task %s in manifest: %s\n", c.Id, err)
+	}
+}
+
+// buffers s and writes all complete lines
+// in grouped mode, everything is buffered until Flush()
+func (w *TaskWriter) WriteString(s string) (int, error) {
+	w.buf += s
+	if w.output.Mode == OUTPUT_MODE_GROUPED {
+		return len(s), nil
+	}
+	if i := strings.LastIndex(w.buf, "\n"); i >= 0 {
+		lines := w.buf[:i+1]
+		w.buf = w.buf[i+1:]
+		if err := w.write(lines); err != nil {
+			return 0, err
+		}
+	}
+	return len(s), nil
+}
+
+// writes buffered output, a prefixed incomplete last line is terminated
+func (w *TaskWriter) Flush() error {
+	if w.buf == "" {
+		return nil
+	}
+	if w.prefix != "" && !strings.HasSuffix(w.buf, "\n") {
+		w.buf += "\n"
+	}
+	lines := w.buf
+	w.buf = ""
+	return w.write(lines)
+}
+
+// private
+
+// opens the task's files for appending, a resumed task continues them
+func (o *Output) fileWriters(c *Command) (StringWriter, StringWriter, error) {
+	stdout, err := openOutputFile(filepath.Join(o.Dir, c.Id+".stdout"))
+	if err != nil {
+		return nil, nil, err
+	}
+	stderr, err := openOutputFile(filepath.Join(o.Dir, c.Id+".stderr"))
+	if err != nil {
+		stdout.Close()
+		return nil, nil, err
+	}
+	return stdout, stderr, nil
+}
+
+// writes complete lines at once
+func (w *TaskWriter) write(lines string) error {
+	if w.prefix != "" {
+		lines = w.prefix + strings.Replace(strings.TrimSuffix(lines, "\n"), "\n", "\n"+w.prefix, -1) + "\n"
+	}
+	w.output.mutex <- true
+	defer func() { <-w.output.mutex }()
+	_, err := io.WriteString(w.w, lines)
+	return err
+}
+
+// a file written by a single pailer, closed once the pailer stopped
+type outputFile struct {
+	*os.File
+}
+
+func openOutputFile(path string) (*outputFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{f}, nil
+}
+
+func (f *outputFile) Flush() error {
+	return f.Close()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamWritesCompleteLines(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	o := NewOutput(stdout, stderr, OUTPUT_MODE_STREAM, false, false, false)
+	out, _, _ := o.Writers(&Command{Id: "1", Hostname: "host"})
+
+	out.WriteString("foo\nba")
+	assert.Equal(t, "foo\n", stdout.String())
+	out.WriteString("r\nbaz")
+	assert.Equal(t, "foo\nbar\n", stdout.String())
+	out.(Flusher).Flush()
+	assert.Equal(t, "foo\nbar\nbaz", stdout.String())
+	assert.Equal(t, "", stderr.String())
+}
+
+func TestStreamPrefixesLines(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	o := NewOutput(stdout, stderr, OUTPUT_MODE_STREAM, true, false, false)
+	out1, err1, _ := o.Writers(&Command{Id: "1", Hostname: "a"})
+	out2, _, _ := o.Writers(&Command{Id: "2", Hostname: "b"})
+
+	out1.WriteString("foo")
+	out2.WriteString("bar\n")
+	out1.WriteString("\nbaz\n")
+	err1.WriteString("oops")
+	err1.(Flusher).Flush()
+
+	assert.Equal(t, "[2|b] bar\n[1|a] foo\n[1|a] baz\n", stdout.String())
+	assert.Equal(t, "[1|a] oops\n", stderr.String())
+}
+
+func TestPrefixColors(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	o := NewOutput(stdout, &bytes.Buffer{}, OUTPUT_MODE_STREAM, true, true, true)
+	out1, _, _ := o.Writers(&Command{Id: "1", Hostname: "a"})
+	out2, _, _ := o.Writers(&Command{Id: "2", Hostname: "a"})
+
+	out1.WriteString("foo\n")
+	out2.WriteString("bar\n")
+
+	assert.Equal(t, ansiColors[0]+"[1|a] "+ANSI_RESET+"foo\n"+ansiColors[1]+"[2|a] "+ANSI_RESET+"bar\n", stdout.String())
+}
+
+func TestPrefixColorsPerStream(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	o := NewOutput(stdout, stderr, OUTPUT_MODE_STREAM, true, false, true)
+	out, err, _ := o.Writers(&Command{Id: "1", Hostname: "a"})
+
+	out.WriteString("foo\n")
+	err.WriteString("oops\n")
+
+	assert.Equal(t, "[1|a] foo\n", stdout.String())
+	assert.Equal(t, ansiColors[0]+"[1|a] "+ANSI_RESET+"oops\n", stderr.String())
+}
+
+func TestGroupedWritesOnFlush(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	o := NewOutput(stdout, &bytes.Buffer{}, OUTPUT_MODE_GROUPED, false, false, false)
+	out1, _, _ := o.Writers(&Command{Id: "1"})
+	out2, _, _ := o.Writers(&Command{Id: "2"})
+
+	out1.WriteString("foo\n")
+	out2.WriteString("bar\n")
+	out1.WriteString("baz\n")
+	assert.Equal(t, "", stdout.String())
+
+	out2.(Flusher).Flush()
+	out1.(Flusher).Flush()
+	assert.Equal(t, "bar\nfoo\nbaz\n", stdout.String())
+}
+
+func TestIsValidOutputMode(t *testing.T) {
+	assert.True(t, IsValidOutputMode(OUTPUT_MODE_STREAM))
+	assert.True(t, IsValidOutputMode(OUTPUT_MODE_GROUPED))
+	assert.False(t, IsValidOutputMode("foo"))
+}
+
+func TestDirOutputWritesFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "none-output")
+	defer os.RemoveAll(dir)
+
+	o, err := NewDirOutput(filepath.Join(dir, "out"))
+	assert.Nil(t, err)
+	out, errs, err := o.Writers(&Command{Id: "3"})
+	assert.Nil(t, err)
+
+	out.WriteString("foo\nbar")
+	errs.WriteString("oops")
+	out.(Flusher).Flush()
+	errs.(Flusher).Flush()
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "out", "3.stdout"))
+	assert.Equal(t, "foo\nbar", string(data))
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "out", "3.stderr"))
+	assert.Equal(t, "oops", string(data))
+
+	// a resumed task appends to its files
+	out, _, _ = o.Writers(&Command{Id: "3"})
+	out.WriteString("baz")
+	out.(Flusher).Flush()
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "out", "3.stdout"))
+	assert.Equal(t, "foo\nbarbaz", string(data))
+}
@@ -4,8 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
+	"os"
+	"sync"
 	"time"
 
 	log "github.com/golang/glog"
@@ -13,23 +14,31 @@ import (
 
 const (
 	PAILER_CHUNK_SIZE = 50000
-	PAILER_INTERVAL   = 1 * time.Second
-	PAILER_STOP_DELAY = 3 * time.Second
+	// polling backs off while a file does not grow and speeds up again once it does
+	PAILER_MIN_INTERVAL = 100 * time.Millisecond
+	PAILER_MAX_INTERVAL = 5 * time.Second
 )
 
 type StringWriter interface {
 	WriteString(string) (int, error)
 }
 
+// writers buffering output are flushed once the pailer stopped
+type Flusher interface {
+	Flush() error
+}
+
 type Pailer struct {
 	BaseUrl  string
 	BasePath string
 	Path     string
 	Offset   int
 	writer   StringWriter
-	running  bool
-	ticker   *time.Ticker
+	stop     chan bool
+	stopped  sync.Once
 	wait     chan bool
+	mutex    sync.Mutex
+	denied   bool
 }
 
 type update struct {
@@ -37,40 +46,54 @@ type update struct {
 	Data   string
 }
 
-// get a pailer pointing to task's file
-func NewPailer(w StringWriter, master *string, command *Command, path string) (*Pailer, error) {
+// get a pailer pointing to a file in task's sandbox directory
+func NewPailer(w StringWriter, slaveUrl, dir, path string) (*Pailer, error) {
+	return NewPailerAt(w, slaveUrl, dir, path, 0)
+}
+
+// get a pailer continuing at offset, e.g. after resuming a NONE run
+func NewPailerAt(w StringWriter, slaveUrl, dir, path string, offset int) (*Pailer, error) {
 	if w == nil {
 		return nil, fmt.Errorf("w must not be nil")
 	}
 
-	su, d, err := FetchSlaveDirInfo(master, command)
-	if err != nil {
-		return nil, err
-	}
-
 	return &Pailer{
-		BaseUrl:  fmt.Sprintf("%s/files/read.json", su),
-		BasePath: d,
+		BaseUrl:  fmt.Sprintf("%s/files/read.json", slaveUrl),
+		BasePath: dir,
 		Path:     path,
-		Offset:   0,
+		Offset:   offset,
 		writer:   w,
-		running:  false,
+		stop:     make(chan bool),
 		wait:     make(chan bool, 1),
 	}, nil
 }
 
+// read the first chunk of a file in task's sandbox directory
+func ReadSandboxFile(slaveUrl, dir, path string) (string, error) {
+	p := &Pailer{
+		BaseUrl:  fmt.Sprintf("%s/files/read.json", slaveUrl),
+		BasePath: dir,
+		Path:     path,
+	}
+	u, err := p.fetch()
+	if err != nil {
+		return "", err
+	}
+	return u.Data, nil
+}
+
 // start the pailer
 func (p *Pailer) Start() {
 	log.Infof("Start pailing: %s %s/%s", p.BaseUrl, p.BasePath, p.Path)
-	p.running = true
-	p.ticker = time.NewTicker(PAILER_INTERVAL)
 	go p.tick()
 }
 
-// stop the pailer
+// stop the pailer, safe to call more than once
 func (p *Pailer) Stop() {
-	log.Infof("Stopping pailer: %s %s/%s", p.BaseUrl, p.BasePath, p.Path)
-	p.running = false
+	p.stopped.Do(func() {
+		log.Infof("Stopping pailer: %s %s/%s", p.BaseUrl, p.BasePath, p.Path)
+		close(p.stop)
+	})
 }
 
 // wait for pailer to finish last fetch
@@ -80,6 +103,13 @@ func (p *Pailer) Wait() {
 	p.wait <- true
 }
 
+// returns the offset of the next chunk to read, safe to call while the pailer is running
+func (p *Pailer) GetOffset() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.Offset
+}
+
 // fetch update via http
 func (p *Pailer) fetch() (*update, error) {
 	url := fmt.Sprintf("%s?length=%d&offset=%d&path=%s",
@@ -87,11 +117,14 @@ func (p *Pailer) fetch() (*update, error) {
 		PAILER_CHUNK_SIZE,
 		p.Offset,
 		url.QueryEscape(fmt.Sprintf("%s/%s", p.BasePath, p.Path)))
-	resp, err := http.Get(url)
+	resp, err := httpClient.Get(url)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
 	return p.decode(resp.Body)
 }
 
@@ -107,26 +140,69 @@ func (p *Pailer) decode(r io.Reader) (*update, error) {
 
 // apply fetched update
 func (p *Pailer) update(u *update) {
-	p.Offset = u.Offset + len(u.Data)
 	p.writer.WriteString(u.Data)
+	p.mutex.Lock()
+	p.Offset = u.Offset + len(u.Data)
+	p.mutex.Unlock()
 }
 
-// fetch update and apply
-func (p *Pailer) fetchAndUpdate() {
-	u, err := p.fetch()
-	if err != nil {
-		log.Errorf("Fetching pailer update failed: %s", err)
-	} else {
+// fetch chunks until caught up with the file
+// returns the number of bytes read
+func (p *Pailer) drain() int {
+	read := 0
+	for {
+		u, err := p.fetch()
+		if err != nil {
+			log.Errorf("Fetching pailer update failed: %s", err)
+			// retrying won't help, tell the user once
+			if _, ok := err.(*HttpAuthError); ok && !p.denied {
+				p.denied = true
+				fmt.Fprintf(os.Stderr, "NONE: unable to stream %s: %s\n", p.Path, err)
+			}
+			return read
+		}
 		p.update(u)
+		read += len(u.Data)
+		if len(u.Data) < PAILER_CHUNK_SIZE {
+			return read
+		}
 	}
 }
 
-// fetch updates every Xs
+// drain the file, polling more often while it grows
 func (p *Pailer) tick() {
-	for p.running {
-		p.fetchAndUpdate()
-		<-p.ticker.C
+	interval := PAILER_MIN_INTERVAL
+	for {
+		if p.drain() > 0 {
+			interval = PAILER_MIN_INTERVAL
+		} else {
+			interval = nextPailerInterval(interval)
+		}
+
+		select {
+		case <-p.stop:
+			// catch up with the output written before the task ended
+			p.drain()
+			p.flush()
+			p.wait <- true
+			return
+		case <-time.After(interval):
+		}
 	}
-	p.fetchAndUpdate()
-	p.wait <- true
+}
+
+func (p *Pailer) flush() {
+	if f, ok := p.writer.(Flusher); ok {
+		if err := f.Flush(); err != nil {
+			log.Errorf("Flushing output failed: %s", err)
+		}
+	}
+}
+
+func nextPailerInterval(interval time.Duration) time.Duration {
+	interval *= 2
+	if interval > PAILER_MAX_INTERVAL {
+		return PAILER_MAX_INTERVAL
+	}
+	return interval
 }
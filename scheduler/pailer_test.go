@@ -1,7 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -9,14 +16,29 @@ import (
 type MockStringWriter struct {
 	LastString string
 	Writes     int
+	Data       string
 }
 
 func (m *MockStringWriter) WriteString(s string) (int, error) {
 	m.LastString = s
 	m.Writes++
+	m.Data += s
 	return 0, nil
 }
 
+// serves chunks of content like the slave's files/read.json
+func newFileServer(content string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		length, _ := strconv.Atoi(r.URL.Query().Get("length"))
+		end := offset + length
+		if end > len(content) {
+			end = len(content)
+		}
+		json.NewEncoder(w).Encode(&update{Offset: offset, Data: content[offset:end]})
+	}))
+}
+
 func TestUpdate(t *testing.T) {
 	m := &MockStringWriter{}
 	p := &Pailer{writer: m}
@@ -41,3 +63,97 @@ func TestUpdate(t *testing.T) {
 	assert.Equal(t, "bar", m.LastString)
 	assert.Equal(t, 2, m.Writes)
 }
+
+func TestReadSandboxFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/files/read.json", r.URL.Path)
+		assert.Equal(t, "/sandbox/cmd.exitcode", r.URL.Query().Get("path"))
+		assert.Equal(t, "0", r.URL.Query().Get("offset"))
+		fmt.Fprintln(w, `{"offset": 0, "data": "3\n"}`)
+	}))
+	defer ts.Close()
+
+	data, err := ReadSandboxFile(ts.URL, "/sandbox", "cmd.exitcode")
+	assert.Nil(t, err)
+	assert.Equal(t, "3\n", data)
+}
+
+func TestDrainReadsAllChunks(t *testing.T) {
+	content := strings.Repeat("x", 2*PAILER_CHUNK_SIZE+10)
+	ts := newFileServer(content)
+	defer ts.Close()
+
+	m := &MockStringWriter{}
+	p, _ := NewPailer(m, ts.URL, "/sandbox", "stdout")
+
+	assert.Equal(t, len(content), p.drain())
+	assert.Equal(t, 3, m.Writes)
+	assert.Equal(t, content, m.Data)
+	assert.Equal(t, len(content), p.GetOffset())
+
+	assert.Equal(t, 0, p.drain())
+}
+
+func TestDrainContinuesAtOffset(t *testing.T) {
+	ts := newFileServer("foobar")
+	defer ts.Close()
+
+	m := &MockStringWriter{}
+	p, _ := NewPailerAt(m, ts.URL, "/sandbox", "stdout", 3)
+
+	assert.Equal(t, 3, p.drain())
+	assert.Equal(t, "bar", m.Data)
+}
+
+func TestStopFetchesRemainingOutput(t *testing.T) {
+	ts := newFileServer("foo")
+	defer ts.Close()
+
+	m := &MockStringWriter{}
+	p, _ := NewPailer(m, ts.URL, "/sandbox", "stdout")
+	p.Start()
+	p.Stop()
+	p.Stop()
+
+	done := make(chan bool)
+	go func() {
+		p.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("pailer did not stop")
+	}
+	assert.Equal(t, "foo", m.Data)
+}
+
+func TestNextPailerInterval(t *testing.T) {
+	assert.Equal(t, 2*PAILER_MIN_INTERVAL, nextPailerInterval(PAILER_MIN_INTERVAL))
+	assert.Equal(t, PAILER_MAX_INTERVAL, nextPailerInterval(PAILER_MAX_INTERVAL))
+	assert.Equal(t, PAILER_MAX_INTERVAL, nextPailerInterval(PAILER_MAX_INTERVAL-time.Millisecond))
+}
+
+type MockFlushingWriter struct {
+	MockStringWriter
+	Flushed bool
+}
+
+func (m *MockFlushingWriter) Flush() error {
+	m.Flushed = true
+	return nil
+}
+
+func TestStopFlushesWriter(t *testing.T) {
+	ts := newFileServer("foo")
+	defer ts.Close()
+
+	m := &MockFlushingWriter{}
+	p, _ := NewPailer(m, ts.URL, "/sandbox", "stdout")
+	p.Start()
+	p.Stop()
+	p.Wait()
+
+	assert.Equal(t, "foo", m.Data)
+	assert.True(t, m.Flushed)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+const (
+	PLACEMENT_FIRST_FIT = "first-fit"
+	PLACEMENT_BEST_FIT  = "best-fit"
+	PLACEMENT_SPREAD    = "spread"
+)
+
+// an offer during placement, reduced by the tasks placed on it so far
+type OfferSlot struct {
+	Offer     *mesos.Offer
+	Remaining *Resources
+	Tasks     []*mesos.TaskInfo
+}
+
+// picks the offer a command is launched with
+type Placement interface {
+	// candidates fit c and are never empty, placed are all active commands
+	Select(c *Command, candidates []*OfferSlot, placed []*Command) *OfferSlot
+}
+
+func NewPlacement(name string) (Placement, error) {
+	switch name {
+	case PLACEMENT_FIRST_FIT:
+		return &FirstFitPlacement{}, nil
+	case PLACEMENT_BEST_FIT:
+		return &BestFitPlacement{}, nil
+	case PLACEMENT_SPREAD:
+		return &SpreadPlacement{}, nil
+	}
+	return nil, fmt.Errorf("Unknown placement %s, expected one of %s, %s or %s", name, PLACEMENT_FIRST_FIT, PLACEMENT_BEST_FIT, PLACEMENT_SPREAD)
+}
+
+// fills the offers in the order they were received
+type FirstFitPlacement struct{}
+
+func (p *FirstFitPlacement) Select(c *Command, candidates []*OfferSlot, placed []*Command) *OfferSlot {
+	return candidates[0]
+}
+
+// packs tasks into the offer they fill best, keeping other slaves free for large tasks
+type BestFitPlacement struct{}
+
+func (p *BestFitPlacement) Select(c *Command, candidates []*OfferSlot, placed []*Command) *OfferSlot {
+	best := candidates[0]
+	bestSlack := slack(best.Remaining, c)
+	for _, slot := range candidates[1:] {
+		if s := slack(slot.Remaining, c); s < bestSlack {
+			best, bestSlack = slot, s
+		}
+	}
+	return best
+}
+
+// prefers the slave running the fewest tasks of this run
+type SpreadPlacement struct{}
+
+func (p *SpreadPlacement) Select(c *Command, candidates []*OfferSlot, placed []*Command) *OfferSlot {
+	tasks := map[string]int{}
+	for _, c := range placed {
+		tasks[c.SlaveId]++
+	}
+	best := candidates[0]
+	for _, slot := range candidates[1:] {
+		if tasks[slot.Offer.SlaveId.GetValue()] < tasks[best.Offer.SlaveId.GetValue()] {
+			best = slot
+		}
+	}
+	return best
+}
+
+// private
+
+// the share of the remaining resources left unused after placing c, summed over the requested resources
+func slack(r *Resources, c *Command) float64 {
+	requests := c.ScalarRequests()
+	s := 0.0
+	// summing in a fixed order keeps equal offers equal
+	for _, name := range sortedResourceNames(requests) {
+		if v := r.Scalar(name); v > 0 {
+			s += (v - requests[name]) / v
+		}
+	}
+	return s
+}
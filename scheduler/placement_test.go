@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSlots(offers ...*mesos.Offer) []*OfferSlot {
+	slots := []*OfferSlot{}
+	for _, o := range offers {
+		slots = append(slots, &OfferSlot{Offer: o, Remaining: NewResources(o.Resources)})
+	}
+	return slots
+}
+
+func TestNewPlacement(t *testing.T) {
+	p, err := NewPlacement("first-fit")
+	assert.Nil(t, err)
+	assert.IsType(t, &FirstFitPlacement{}, p)
+	p, err = NewPlacement("best-fit")
+	assert.Nil(t, err)
+	assert.IsType(t, &BestFitPlacement{}, p)
+	p, err = NewPlacement("spread")
+	assert.Nil(t, err)
+	assert.IsType(t, &SpreadPlacement{}, p)
+
+	_, err = NewPlacement("random")
+	assert.NotNil(t, err)
+}
+
+func TestFirstFitPlacement(t *testing.T) {
+	slots := newTestSlots(newTestOffer("1", 4, 1024), newTestOffer("2", 1, 128))
+	c := &Command{CpuReq: 1, MemReq: 128}
+	assert.Equal(t, slots[0], (&FirstFitPlacement{}).Select(c, slots, nil))
+}
+
+func TestBestFitPlacement(t *testing.T) {
+	slots := newTestSlots(newTestOffer("1", 4, 1024), newTestOffer("2", 1, 256), newTestOffer("3", 1, 192))
+	c := &Command{CpuReq: 1, MemReq: 128}
+	assert.Equal(t, slots[2], (&BestFitPlacement{}).Select(c, slots, nil))
+	assert.Equal(t, slots[0], (&BestFitPlacement{}).Select(c, slots[:1], nil))
+}
+
+func TestSpreadPlacement(t *testing.T) {
+	slots := newTestSlots(newTestOffer("1", 4, 1024), newTestOffer("2", 4, 1024), newTestOffer("3", 4, 1024))
+	c := &Command{CpuReq: 1, MemReq: 128}
+	placed := []*Command{{SlaveId: "slave-1"}, {SlaveId: "slave-1"}, {SlaveId: "slave-2"}}
+
+	assert.Equal(t, slots[2], (&SpreadPlacement{}).Select(c, slots, placed))
+	assert.Equal(t, slots[1], (&SpreadPlacement{}).Select(c, slots[:2], placed))
+	assert.Equal(t, slots[0], (&SpreadPlacement{}).Select(c, slots, nil))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/golang/glog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+	sched "github.com/mesos/mesos-go/scheduler"
+)
+
+const (
+	DEFAULT_RECONCILE_INTERVAL = 5 * time.Minute
+)
+
+// asks the master for the state of running tasks and keeps track of unconfirmed tasks
+type Reconciler struct {
+	Timeout time.Duration
+	pending map[string]time.Time
+}
+
+func NewReconciler(timeout time.Duration) *Reconciler {
+	return &Reconciler{
+		Timeout: timeout,
+		pending: make(map[string]time.Time),
+	}
+}
+
+// request explicit reconciliation for commands and implicit reconciliation for all other tasks
+func (r *Reconciler) Reconcile(driver sched.SchedulerDriver, commands []*Command) {
+	now := time.Now()
+	statuses := []*mesos.TaskStatus{}
+	for _, c := range commands {
+		if _, ok := r.pending[c.Id]; !ok {
+			r.pending[c.Id] = now
+		}
+		s := util.NewTaskStatus(util.NewTaskID(c.Id), c.Status.GetState())
+		s.SlaveId = util.NewSlaveID(c.SlaveId)
+		statuses = append(statuses, s)
+	}
+
+	if len(statuses) > 0 {
+		log.Infoln("Reconciling", len(statuses), "tasks")
+		driver.ReconcileTasks(statuses)
+	}
+	driver.ReconcileTasks([]*mesos.TaskStatus{})
+}
+
+// the task's state was confirmed by a status update
+func (r *Reconciler) Confirm(taskId string) {
+	delete(r.pending, taskId)
+}
+
+// returns ids of tasks without status update for longer than Timeout since reconciliation was requested
+func (r *Reconciler) Expired() []string {
+	ids := []string{}
+	if r.Timeout <= 0 {
+		return ids
+	}
+	for id, t := range r.pending {
+		if time.Since(t) >= r.Timeout {
+			ids = append(ids, id)
+			delete(r.pending, id)
+		}
+	}
+	return ids
+}
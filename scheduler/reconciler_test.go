@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReconcileRequestsExplicitAndImplicit(t *testing.T) {
+	r := NewReconciler(time.Minute)
+	c := &Command{Id: "1", SlaveId: "slave-1"}
+
+	d := &MockSchedulerDriver{}
+	d.On("ReconcileTasks", mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	r.Reconcile(d, []*Command{c})
+	d.AssertNumberOfCalls(t, "ReconcileTasks", 2)
+
+	explicit := d.Calls[0].Arguments.Get(0).([]*mesos.TaskStatus)
+	assert.Equal(t, 1, len(explicit))
+	assert.Equal(t, "1", explicit[0].GetTaskId().GetValue())
+	assert.Equal(t, "slave-1", explicit[0].GetSlaveId().GetValue())
+	assert.Equal(t, 0, len(d.Calls[1].Arguments.Get(0).([]*mesos.TaskStatus)))
+}
+
+func TestReconcilerExpired(t *testing.T) {
+	r := NewReconciler(time.Millisecond)
+	d := &MockSchedulerDriver{}
+	d.On("ReconcileTasks", mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	r.Reconcile(d, []*Command{{Id: "1"}, {Id: "2"}})
+	r.Confirm("1")
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Equal(t, []string{"2"}, r.Expired())
+	assert.Equal(t, 0, len(r.Expired()), "expired tasks should be reported once")
+}
+
+func TestReconcilerWithoutTimeout(t *testing.T) {
+	r := NewReconciler(0)
+	d := &MockSchedulerDriver{}
+	d.On("ReconcileTasks", mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	r.Reconcile(d, []*Command{{Id: "1"}})
+	assert.Equal(t, 0, len(r.Expired()))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// limits the size of a single record to protect against corrupt streams
+const RECORDIO_MAX_RECORD_SIZE = 64 * 1024 * 1024
+
+// reads records framed as "<length>\n<record>", used by the streaming HTTP API of mesos
+type RecordReader struct {
+	r *bufio.Reader
+}
+
+func NewRecordReader(r io.Reader) *RecordReader {
+	return &RecordReader{r: bufio.NewReader(r)}
+}
+
+// returns the next record, io.EOF at the end of the stream
+func (rr *RecordReader) Read() ([]byte, error) {
+	header, err := rr.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && header != "" {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	size, err := strconv.ParseUint(strings.TrimSpace(header), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid record header %q", header)
+	}
+	if size > RECORDIO_MAX_RECORD_SIZE {
+		return nil, fmt.Errorf("Record of %d bytes exceeds the maximum of %d bytes", size, RECORDIO_MAX_RECORD_SIZE)
+	}
+	record := make([]byte, size)
+	if _, err := io.ReadFull(rr.r, record); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// writes a record with its header
+func WriteRecord(w io.Writer, record []byte) error {
+	if _, err := fmt.Fprintf(w, "%d\n", len(record)); err != nil {
+		return err
+	}
+	_, err := w.Write(record)
+	return err
+}
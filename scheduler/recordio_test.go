@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReader(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, WriteRecord(&b, []byte(`{"type":"HEARTBEAT"}`)))
+	assert.NoError(t, WriteRecord(&b, []byte("foo\nbar")))
+
+	rr := NewRecordReader(&b)
+	r, err := rr.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type":"HEARTBEAT"}`, string(r))
+	r, err = rr.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, "foo\nbar", string(r))
+	_, err = rr.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRecordReaderTruncated(t *testing.T) {
+	_, err := NewRecordReader(strings.NewReader("10\nfoo")).Read()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = NewRecordReader(strings.NewReader("foo\nbar")).Read()
+	assert.Error(t, err)
+}
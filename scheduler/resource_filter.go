@@ -10,24 +10,17 @@ type ResourceFilter struct {
 	Constraints Constraint
 }
 
-func (rf *ResourceFilter) FilterOffer(offer *mesos.Offer) bool {
-	return rf.Constraints.Match(offer)
+func (rf *ResourceFilter) FilterOffer(offer *mesos.Offer, placed []*Command) bool {
+	return rf.Constraints.Match(offer, placed)
 }
 
-func (rf *ResourceFilter) FilterResources(offer *mesos.Offer, name string) []*mesos.Resource {
-	return util.FilterResources(offer.Resources, func(res *mesos.Resource) bool {
-		return res.GetName() == name && rf.filterRole(res.GetRole())
-	})
+// returns all resources of the offer usable by the framework's role
+func (rf *ResourceFilter) OfferResources(offer *mesos.Offer) *Resources {
+	return NewResources(util.FilterResources(offer.Resources, func(res *mesos.Resource) bool {
+		return rf.filterRole(res.GetRole())
+	}))
 }
 
 func (rf *ResourceFilter) filterRole(role string) bool {
 	return role == "*" || rf.Role != nil && role == *rf.Role
 }
-
-func SumScalarResources(res []*mesos.Resource) float64 {
-	v := 0.0
-	for _, res := range res {
-		v += res.GetScalar().GetValue()
-	}
-	return v
-}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+)
+
+const (
+	RESOURCE_PORTS = "ports"
+	// ignore rounding errors when taking scalars from several resources
+	RESOURCE_EPSILON = 1e-9
+)
+
+// resources of an offer, reduced by every task placed on it
+// resources of the same name are kept apart by role and reservation
+type Resources struct {
+	resources []*mesos.Resource
+}
+
+// reserved resources come first, so they are used before unreserved ones
+func NewResources(resources []*mesos.Resource) *Resources {
+	r := &Resources{resources: []*mesos.Resource{}}
+	for _, res := range resources {
+		switch res.GetType() {
+		case mesos.Value_SCALAR:
+			r.resources = append(r.resources, newAllocatedResource(res, res.GetScalar().GetValue(), nil))
+		case mesos.Value_RANGES:
+			// copies, allocating values changes the ranges
+			ranges := []*mesos.Value_Range{}
+			for _, rng := range res.GetRanges().GetRange() {
+				ranges = append(ranges, util.NewValueRange(rng.GetBegin(), rng.GetEnd()))
+			}
+			r.resources = append(r.resources, newAllocatedResource(res, 0, ranges))
+		}
+	}
+	sort.SliceStable(r.resources, func(i, j int) bool {
+		return isReserved(r.resources[i]) && !isReserved(r.resources[j])
+	})
+	return r
+}
+
+// returns the sum of all scalar resources with name
+func (r *Resources) Scalar(name string) float64 {
+	v := 0.0
+	for _, res := range r.resources {
+		if res.GetName() == name && res.GetType() == mesos.Value_SCALAR {
+			v += res.GetScalar().GetValue()
+		}
+	}
+	return v
+}
+
+// returns all ranges of resources with name
+func (r *Resources) Ranges(name string) []*mesos.Value_Range {
+	ranges := []*mesos.Value_Range{}
+	for _, res := range r.resources {
+		if res.GetName() == name && res.GetType() == mesos.Value_RANGES {
+			ranges = append(ranges, res.GetRanges().GetRange()...)
+		}
+	}
+	return ranges
+}
+
+// checks if the resources suffice for launching c
+func (r *Resources) Contain(c *Command) bool {
+	for name, v := range c.ScalarRequests() {
+		if r.Scalar(name) < v-RESOURCE_EPSILON {
+			return false
+		}
+	}
+	return uint64(c.Ports) <= countRangeValues(r.Ranges(RESOURCE_PORTS))
+}
+
+// takes the resources of c, Contain(c) must be checked first
+// returns the taken resources with the role and reservation they were offered with
+func (r *Resources) Allocate(c *Command) []*mesos.Resource {
+	allocated := []*mesos.Resource{}
+	requests := c.ScalarRequests()
+	for _, name := range sortedResourceNames(requests) {
+		need := requests[name]
+		for _, res := range r.resources {
+			if need <= RESOURCE_EPSILON {
+				break
+			}
+			if res.GetName() != name || res.GetType() != mesos.Value_SCALAR || res.GetScalar().GetValue() <= 0 {
+				continue
+			}
+			take := math.Min(need, res.GetScalar().GetValue())
+			*res.Scalar.Value -= take
+			need -= take
+			allocated = append(allocated, newAllocatedResource(res, take, nil))
+		}
+	}
+
+	need := c.Ports
+	for _, res := range r.resources {
+		if need == 0 {
+			break
+		}
+		if res.GetName() != RESOURCE_PORTS || res.GetType() != mesos.Value_RANGES {
+			continue
+		}
+		ports := []uint64{}
+		for _, rng := range res.GetRanges().GetRange() {
+			for len(ports) < need && rng.GetBegin() <= rng.GetEnd() {
+				ports = append(ports, rng.GetBegin())
+				*rng.Begin++
+			}
+		}
+		if len(ports) > 0 {
+			need -= len(ports)
+			allocated = append(allocated, newAllocatedResource(res, 0, newValueRanges(ports)))
+		}
+	}
+	return allocated
+}
+
+func (r *Resources) String() string {
+	types := map[string]mesos.Value_Type{}
+	names := []string{}
+	for _, res := range r.resources {
+		if _, ok := types[res.GetName()]; !ok {
+			names = append(names, res.GetName())
+		}
+		types[res.GetName()] = res.GetType()
+	}
+	sort.Strings(names)
+
+	parts := []string{}
+	for _, name := range names {
+		if types[name] == mesos.Value_SCALAR {
+			parts = append(parts, fmt.Sprintf("%s=%g", name, r.Scalar(name)))
+			continue
+		}
+		rs := []string{}
+		for _, rng := range r.Ranges(name) {
+			if rng.GetBegin() <= rng.GetEnd() {
+				rs = append(rs, fmt.Sprintf("%d-%d", rng.GetBegin(), rng.GetEnd()))
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s=[%s]", name, strings.Join(rs, ",")))
+	}
+	return strings.Join(parts, " ")
+}
+
+// returns all values of range resources with name, e.g. the allocated ports
+func RangeValues(resources []*mesos.Resource, name string) []uint64 {
+	values := []uint64{}
+	for _, res := range resources {
+		if res.GetName() != name || res.GetType() != mesos.Value_RANGES {
+			continue
+		}
+		for _, rng := range res.GetRanges().GetRange() {
+			for v := rng.GetBegin(); v <= rng.GetEnd(); v++ {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// parses scalar resources <name:value[;..]>
+func ParseScalarResources(s string) (map[string]float64, error) {
+	res := map[string]float64{}
+	for _, part := range strings.Split(s, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid resource %s, expected <name:value>", part)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("Invalid value of resource %s", part)
+		}
+		res[strings.TrimSpace(kv[0])] = v
+	}
+	return res, nil
+}
+
+// private
+
+func countRangeValues(ranges []*mesos.Value_Range) uint64 {
+	n := uint64(0)
+	for _, rng := range ranges {
+		if rng.GetBegin() <= rng.GetEnd() {
+			n += rng.GetEnd() - rng.GetBegin() + 1
+		}
+	}
+	return n
+}
+
+// joins consecutive values to ranges
+func newValueRanges(values []uint64) []*mesos.Value_Range {
+	ranges := []*mesos.Value_Range{}
+	for _, v := range values {
+		if n := len(ranges); n > 0 && ranges[n-1].GetEnd()+1 == v {
+			*ranges[n-1].End = v
+		} else {
+			ranges = append(ranges, util.NewValueRange(v, v))
+		}
+	}
+	return ranges
+}
+
+func sortedResourceNames(res map[string]float64) []string {
+	names := make([]string, 0, len(res))
+	for n := range res {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// a copy of res with the given value
+// all other fields like role, reservation, disk and revocable must match the offer
+func newAllocatedResource(res *mesos.Resource, scalar float64, ranges []*mesos.Value_Range) *mesos.Resource {
+	a := proto.Clone(res).(*mesos.Resource)
+	if ranges != nil {
+		a.Ranges = &mesos.Value_Ranges{Range: ranges}
+	} else {
+		a.Scalar = &mesos.Value_Scalar{Value: proto.Float64(scalar)}
+	}
+	return a
+}
+
+// dynamically or statically reserved for a role
+func isReserved(res *mesos.Resource) bool {
+	return res.GetRole() != "*" || res.GetReservation() != nil
+}
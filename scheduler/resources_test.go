@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestResources() *Resources {
+	return NewResources([]*mesos.Resource{
+		util.NewScalarResource("cpus", 4),
+		util.NewScalarResource("mem", 1024),
+		util.NewScalarResource("licenses", 1),
+		util.NewRangesResource("ports", []*mesos.Value_Range{util.NewValueRange(31000, 31001), util.NewValueRange(31005, 31005)}),
+	})
+}
+
+func TestResourcesContain(t *testing.T) {
+	r := newTestResources()
+
+	assert.True(t, r.Contain(&Command{CpuReq: 4, MemReq: 1024}))
+	assert.False(t, r.Contain(&Command{CpuReq: 5, MemReq: 1024}))
+	assert.False(t, r.Contain(&Command{CpuReq: 1, MemReq: 128, DiskReq: 1}))
+	assert.True(t, r.Contain(&Command{CpuReq: 1, MemReq: 128, Resources: map[string]float64{"licenses": 1}}))
+	assert.False(t, r.Contain(&Command{CpuReq: 1, MemReq: 128, Resources: map[string]float64{"licenses": 2}}))
+	assert.False(t, r.Contain(&Command{CpuReq: 1, MemReq: 128, Resources: map[string]float64{"gpus": 1}}))
+	assert.True(t, r.Contain(&Command{CpuReq: 1, MemReq: 128, Ports: 3}))
+	assert.False(t, r.Contain(&Command{CpuReq: 1, MemReq: 128, Ports: 4}))
+}
+
+func TestResourcesAllocate(t *testing.T) {
+	r := newTestResources()
+	c := &Command{CpuReq: 1, MemReq: 128, Ports: 2, Resources: map[string]float64{"licenses": 1}}
+
+	allocated := r.Allocate(c)
+	assert.Equal(t, []uint64{31000, 31001}, RangeValues(allocated, "ports"))
+	assert.Equal(t, 3.0, r.Scalar("cpus"))
+	assert.Equal(t, 896.0, r.Scalar("mem"))
+	assert.Equal(t, 0.0, r.Scalar("licenses"))
+	assert.False(t, r.Contain(c))
+
+	c.Resources = nil
+	assert.True(t, r.Contain(&Command{CpuReq: 1, MemReq: 128, Ports: 1}))
+	assert.Equal(t, []uint64{31005}, RangeValues(r.Allocate(&Command{CpuReq: 1, MemReq: 128, Ports: 1}), "ports"))
+	assert.False(t, r.Contain(&Command{CpuReq: 1, MemReq: 128, Ports: 1}))
+	assert.Equal(t, "cpus=2 licenses=0 mem=768 ports=[]", r.String())
+}
+
+func TestResourcesAllocatePrefersReserved(t *testing.T) {
+	cpus := util.NewScalarResource("cpus", 2)
+	cpus.Role = proto.String("batch")
+	mem := util.NewScalarResource("mem", 256)
+	mem.Role = proto.String("batch")
+	mem.Reservation = &mesos.Resource_ReservationInfo{Principal: proto.String("none")}
+	ports := util.NewRangesResource("ports", []*mesos.Value_Range{util.NewValueRange(32000, 32000)})
+	ports.Role = proto.String("batch")
+	r := NewResources([]*mesos.Resource{
+		util.NewScalarResource("cpus", 4),
+		util.NewScalarResource("mem", 1024),
+		util.NewRangesResource("ports", []*mesos.Value_Range{util.NewValueRange(31000, 31001)}),
+		cpus, mem, ports,
+	})
+
+	allocated := r.Allocate(&Command{CpuReq: 3, MemReq: 128, Ports: 2})
+	assert.Len(t, allocated, 5)
+
+	assert.Equal(t, "cpus", allocated[0].GetName())
+	assert.Equal(t, "batch", allocated[0].GetRole())
+	assert.Equal(t, 2.0, allocated[0].GetScalar().GetValue())
+	assert.Equal(t, "cpus", allocated[1].GetName())
+	assert.Equal(t, "*", allocated[1].GetRole())
+	assert.Equal(t, 1.0, allocated[1].GetScalar().GetValue())
+
+	assert.Equal(t, "mem", allocated[2].GetName())
+	assert.Equal(t, "batch", allocated[2].GetRole())
+	assert.Equal(t, "none", allocated[2].GetReservation().GetPrincipal())
+	assert.Equal(t, 128.0, allocated[2].GetScalar().GetValue())
+
+	assert.Equal(t, "batch", allocated[3].GetRole())
+	assert.Equal(t, []uint64{32000}, RangeValues(allocated[3:4], "ports"))
+	assert.Equal(t, "*", allocated[4].GetRole())
+	assert.Equal(t, []uint64{31000}, RangeValues(allocated[4:], "ports"))
+
+	assert.Equal(t, 3.0, r.Scalar("cpus"))
+	assert.Equal(t, 1152.0, r.Scalar("mem"))
+}
+
+func TestResourcesAllocateKeepsOfferedFields(t *testing.T) {
+	disk := util.NewScalarResource("disk", 1024)
+	disk.Role = proto.String("batch")
+	disk.Disk = &mesos.Resource_DiskInfo{}
+	r := NewResources([]*mesos.Resource{util.NewScalarResource("cpus", 1), util.NewScalarResource("mem", 128), disk})
+
+	allocated := r.Allocate(&Command{CpuReq: 1, MemReq: 128, DiskReq: 512})
+	assert.Len(t, allocated, 3)
+	assert.Equal(t, "disk", allocated[1].GetName())
+	assert.Equal(t, 512.0, allocated[1].GetScalar().GetValue())
+	assert.Equal(t, "batch", allocated[1].GetRole())
+	assert.NotNil(t, allocated[1].GetDisk())
+	assert.Equal(t, 512.0, r.Scalar("disk"), "the offered resource should not change with the allocated copy")
+}
+
+func TestParseScalarResources(t *testing.T) {
+	res, err := ParseScalarResources("licenses:1; gpus:0.5")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float64{"licenses": 1, "gpus": 0.5}, res)
+
+	res, err = ParseScalarResources("")
+	assert.Nil(t, err)
+	assert.Empty(t, res)
+
+	_, err = ParseScalarResources("licenses")
+	assert.NotNil(t, err)
+	_, err = ParseScalarResources("licenses:many")
+	assert.NotNil(t, err)
+	_, err = ParseScalarResources("licenses:-1")
+	assert.NotNil(t, err)
+}
+
+func TestNewValueRanges(t *testing.T) {
+	ranges := newValueRanges([]uint64{31000, 31001, 31002, 31005})
+	assert.Len(t, ranges, 2)
+	assert.Equal(t, uint64(31000), ranges[0].GetBegin())
+	assert.Equal(t, uint64(31002), ranges[0].GetEnd())
+	assert.Equal(t, uint64(31005), ranges[1].GetBegin())
+	assert.Equal(t, uint64(31005), ranges[1].GetEnd())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+const (
+	RETRY_MAX_BACKOFF = 5 * time.Minute
+)
+
+// decides whether ended commands are launched again
+type RetryPolicy struct {
+	MaxRetries    int
+	Backoff       time.Duration
+	RetryFailures bool
+}
+
+func NewRetryPolicy(maxRetries int, backoff time.Duration, retryFailures bool) *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:    maxRetries,
+		Backoff:       backoff,
+		RetryFailures: retryFailures,
+	}
+}
+
+// infrastructure failures are always retried, failing commands only if RetryFailures is set
+func (p *RetryPolicy) ShouldRetry(c *Command) bool {
+	if c.Attempt >= p.MaxRetries {
+		return false
+	}
+	if IsInfrastructureFailure(c.Status) {
+		return true
+	}
+	return p.RetryFailures && c.Status.GetState() == mesos.TaskState_TASK_FAILED
+}
+
+// exponential backoff before launching the next attempt
+func (p *RetryPolicy) Delay(c *Command) time.Duration {
+	d := p.Backoff
+	for i := 0; i < c.Attempt && d < RETRY_MAX_BACKOFF; i++ {
+		d *= 2
+	}
+	if d > RETRY_MAX_BACKOFF {
+		return RETRY_MAX_BACKOFF
+	}
+	return d
+}
+
+// checks if a task ended because of lost slaves or executors rather than a failing command
+func IsInfrastructureFailure(status *mesos.TaskStatus) bool {
+	switch status.GetState() {
+	case mesos.TaskState_TASK_LOST:
+		return true
+	case mesos.TaskState_TASK_FAILED:
+		switch status.GetReason() {
+		case mesos.TaskStatus_REASON_EXECUTOR_TERMINATED,
+			mesos.TaskStatus_REASON_EXECUTOR_UNREGISTERED,
+			mesos.TaskStatus_REASON_SLAVE_DISCONNECTED,
+			mesos.TaskStatus_REASON_SLAVE_REMOVED,
+			mesos.TaskStatus_REASON_SLAVE_RESTARTED,
+			mesos.TaskStatus_REASON_SLAVE_UNKNOWN:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCommandWithStatus(state mesos.TaskState, reason mesos.TaskStatus_Reason) *Command {
+	s := util.NewTaskStatus(util.NewTaskID("1"), state)
+	s.Reason = reason.Enum()
+	return &Command{Id: "1", Status: s}
+}
+
+func TestIsInfrastructureFailure(t *testing.T) {
+	assert.True(t, IsInfrastructureFailure(newCommandWithStatus(mesos.TaskState_TASK_LOST, mesos.TaskStatus_REASON_RECONCILIATION).Status))
+	assert.True(t, IsInfrastructureFailure(newCommandWithStatus(mesos.TaskState_TASK_FAILED, mesos.TaskStatus_REASON_SLAVE_REMOVED).Status))
+	assert.True(t, IsInfrastructureFailure(newCommandWithStatus(mesos.TaskState_TASK_FAILED, mesos.TaskStatus_REASON_EXECUTOR_TERMINATED).Status))
+	assert.False(t, IsInfrastructureFailure(newCommandWithStatus(mesos.TaskState_TASK_FAILED, mesos.TaskStatus_REASON_COMMAND_EXECUTOR_FAILED).Status))
+	assert.False(t, IsInfrastructureFailure(newCommandWithStatus(mesos.TaskState_TASK_KILLED, mesos.TaskStatus_REASON_SLAVE_REMOVED).Status))
+	assert.False(t, IsInfrastructureFailure(newCommandWithStatus(mesos.TaskState_TASK_FINISHED, mesos.TaskStatus_REASON_SLAVE_REMOVED).Status))
+}
+
+func TestShouldRetry(t *testing.T) {
+	p := NewRetryPolicy(2, time.Second, false)
+	lost := newCommandWithStatus(mesos.TaskState_TASK_LOST, mesos.TaskStatus_REASON_SLAVE_REMOVED)
+	failed := newCommandWithStatus(mesos.TaskState_TASK_FAILED, mesos.TaskStatus_REASON_COMMAND_EXECUTOR_FAILED)
+	killed := newCommandWithStatus(mesos.TaskState_TASK_KILLED, mesos.TaskStatus_REASON_COMMAND_EXECUTOR_FAILED)
+
+	assert.True(t, p.ShouldRetry(lost))
+	assert.False(t, p.ShouldRetry(failed))
+	assert.False(t, p.ShouldRetry(killed))
+
+	lost.Attempt = 2
+	assert.False(t, p.ShouldRetry(lost), "max retries reached")
+}
+
+func TestShouldRetryFailures(t *testing.T) {
+	p := NewRetryPolicy(1, time.Second, true)
+	failed := newCommandWithStatus(mesos.TaskState_TASK_FAILED, mesos.TaskStatus_REASON_COMMAND_EXECUTOR_FAILED)
+	killed := newCommandWithStatus(mesos.TaskState_TASK_KILLED, mesos.TaskStatus_REASON_COMMAND_EXECUTOR_FAILED)
+
+	assert.True(t, p.ShouldRetry(failed))
+	assert.False(t, p.ShouldRetry(killed))
+}
+
+func TestShouldRetryDisabled(t *testing.T) {
+	p := NewRetryPolicy(0, time.Second, true)
+
+	assert.False(t, p.ShouldRetry(newCommandWithStatus(mesos.TaskState_TASK_LOST, mesos.TaskStatus_REASON_SLAVE_REMOVED)))
+}
+
+func TestDelay(t *testing.T) {
+	p := NewRetryPolicy(20, time.Second, false)
+
+	assert.Equal(t, time.Second, p.Delay(&Command{Attempt: 0}))
+	assert.Equal(t, 2*time.Second, p.Delay(&Command{Attempt: 1}))
+	assert.Equal(t, 8*time.Second, p.Delay(&Command{Attempt: 3}))
+	assert.Equal(t, RETRY_MAX_BACKOFF, p.Delay(&Command{Attempt: 19}))
+}
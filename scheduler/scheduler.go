@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/gogo/protobuf/proto"
 	log "github.com/golang/glog"
 	mesos "github.com/mesos/mesos-go/mesosproto"
@@ -12,6 +14,14 @@ type NoneScheduler struct {
 	queue         CommandQueuer
 	handler       *CommandHandler
 	filter        *ResourceFilter
+	retry         *RetryPolicy
+	reconciler    *Reconciler
+	store         StateStore
+	artifacts     *ArtifactServer
+	placement     Placement
+	lookahead     int
+	mutex         chan bool
+	shutdown      bool
 	frameworkId   string
 	tasksLaunched int
 	tasksFinished int
@@ -19,20 +29,36 @@ type NoneScheduler struct {
 	totalTasks    int
 }
 
-func NewNoneScheduler(cmdq CommandQueuer, handler *CommandHandler, filter *ResourceFilter) *NoneScheduler {
+func NewNoneScheduler(cmdq CommandQueuer, handler *CommandHandler, filter *ResourceFilter, retry *RetryPolicy, reconciler *Reconciler) *NoneScheduler {
 	return &NoneScheduler{
-		queue:   cmdq,
-		handler: handler,
-		filter:  filter,
+		queue:      cmdq,
+		handler:    handler,
+		filter:     filter,
+		retry:      retry,
+		reconciler: reconciler,
+		placement:  &FirstFitPlacement{},
+		lookahead:  1,
+		mutex:      make(chan bool, 1),
 	}
 }
 
 func (sched *NoneScheduler) Registered(driver sched.SchedulerDriver, frameworkId *mesos.FrameworkID, masterInfo *mesos.MasterInfo) {
 	log.Infoln("Framework Registered with Master", masterInfo)
+	sched.mutex <- true
+	defer func() { <-sched.mutex }()
+
 	sched.frameworkId = frameworkId.GetValue()
+	sched.reconcile(driver)
+	sched.checkpoint()
 }
 
-func (sched *NoneScheduler) Reregistered(driver sched.SchedulerDriver, masterInfo *mesos.MasterInfo) {}
+func (sched *NoneScheduler) Reregistered(driver sched.SchedulerDriver, masterInfo *mesos.MasterInfo) {
+	log.Infoln("Framework Reregistered with Master", masterInfo)
+	sched.mutex <- true
+	defer func() { <-sched.mutex }()
+
+	sched.reconcile(driver)
+}
 
 func (sched *NoneScheduler) Disconnected(sched.SchedulerDriver) {
 	log.Infoln("Framework Disconnected")
@@ -40,80 +66,188 @@ func (sched *NoneScheduler) Disconnected(sched.SchedulerDriver) {
 
 // process incoming offers and try to schedule new tasks as they come in on the channel
 func (sched *NoneScheduler) ResourceOffers(driver sched.SchedulerDriver, offers []*mesos.Offer) {
-	if sched.queue.Next() == nil {
+	sched.mutex <- true
+	defer func() { <-sched.mutex }()
+
+	if sched.queue.GetCommand() == nil {
 		// no command to launch, we don't need to parse anything
+		for _, offer := range offers {
+			driver.DeclineOffer(offer.Id, &mesos.Filters{RefuseSeconds: proto.Float64(1)})
+		}
 		return
 	}
 
-	for _, offer := range offers {
-		// match constraints
-		if !sched.filter.FilterOffer(offer) {
-			// skip offer if it does not match constraints
-			continue
-		}
+	slots := make([]*OfferSlot, len(offers))
+	for i, offer := range offers {
+		slots[i] = &OfferSlot{Offer: offer, Remaining: sched.filter.OfferResources(offer)}
+		log.Infoln("Received Offer <", offer.Id.GetValue(), "> with", slots[i].Remaining)
+	}
+
+	// place as many tasks as possible, starting over with the current command after each one
+	for sched.placeCommand(slots) {
+	}
 
-		remainingCpus := SumScalarResources(sched.filter.FilterResources(offer, "cpus"))
-		remainingMems := SumScalarResources(sched.filter.FilterResources(offer, "mem"))
+	for _, slot := range slots {
+		log.Infoln("Launching", len(slot.Tasks), "tasks for offer", slot.Offer.Id.GetValue())
+		driver.LaunchTasks([]*mesos.OfferID{slot.Offer.Id}, slot.Tasks, &mesos.Filters{RefuseSeconds: proto.Float64(1)})
+	}
+	sched.checkpoint()
+}
 
-		log.Infoln("Received Offer <", offer.Id.GetValue(), "> with cpus=", remainingCpus, " mem=", remainingMems)
+func (sched *NoneScheduler) StatusUpdate(driver sched.SchedulerDriver, status *mesos.TaskStatus) {
+	sched.mutex <- true
+	defer func() { <-sched.mutex }()
 
-		// try to schedule as may tasks as possible for this single offer
-		var tasks []*mesos.TaskInfo
-		for sched.queue.GetCommand() != nil &&
-			sched.queue.GetCommand().MatchesResources(remainingCpus, remainingMems) {
+	sched.statusUpdate(driver, status)
+	sched.checkpoint()
+}
 
-			c := sched.queue.GetCommand()
-			c.SlaveId = offer.SlaveId.GetValue()
-			c.FrameworkId = sched.frameworkId
-			sched.handler.CommandLaunched(c)
-			task := sched.prepareTaskInfo(offer, c)
-			tasks = append(tasks, task)
+// restores the commands of a resumed run
+func (sched *NoneScheduler) Restore(frameworkId string, commands []*Command) {
+	sched.mutex <- true
+	defer func() { <-sched.mutex }()
 
-			remainingCpus -= c.CpuReq
-			remainingMems -= c.MemReq
-			sched.queue.Next()
+	sched.frameworkId = frameworkId
+	for _, c := range commands {
+		sched.queue.Restore(c)
+		if c.SlaveId != "" {
+			sched.handler.CommandRestored(c)
 		}
-		log.Infoln("Launching", len(tasks), "tasks for offer", offer.Id.GetValue())
-		driver.LaunchTasks([]*mesos.OfferID{offer.Id}, tasks, &mesos.Filters{RefuseSeconds: proto.Float64(1)})
 	}
 }
 
-func (sched *NoneScheduler) StatusUpdate(driver sched.SchedulerDriver, status *mesos.TaskStatus) {
+// save the state of the run to store on every change and every interval
+// the interval catches newly queued commands and streamed output
+func (sched *NoneScheduler) StartCheckpointing(store StateStore, interval time.Duration) {
+	sched.mutex <- true
+	sched.store = store
+	<-sched.mutex
+
+	go func() {
+		for range time.Tick(interval) {
+			sched.mutex <- true
+			sched.checkpoint()
+			<-sched.mutex
+		}
+	}()
+}
+
+// stop the artifact server once no task is going to fetch artifacts anymore
+func (sched *NoneScheduler) SetArtifactServer(server *ArtifactServer) {
+	sched.mutex <- true
+	defer func() { <-sched.mutex }()
+	sched.artifacts = server
+}
+
+// commands may be launched ahead of up to lookahead-1 commands which don't fit any offer
+func (sched *NoneScheduler) SetPlacement(placement Placement, lookahead int) {
+	sched.mutex <- true
+	defer func() { <-sched.mutex }()
+	sched.placement = placement
+	sched.lookahead = lookahead
+}
+
+// reconcile running tasks every interval
+// tasks without any status update since the last run are considered lost
+func (sched *NoneScheduler) StartReconciliation(driver sched.SchedulerDriver, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			sched.mutex <- true
+			sched.reconcile(driver)
+			<-sched.mutex
+		}
+	}()
+}
+
+func (sched *NoneScheduler) statusUpdate(driver sched.SchedulerDriver, status *mesos.TaskStatus) {
 	taskId := status.GetTaskId().GetValue()
 	log.Infoln("Status update: task", taskId, "is in state", status.State.Enum().String())
+	sched.reconciler.Confirm(taskId)
 
 	c := sched.queue.GetCommandById(taskId)
 	if c == nil {
 		log.Errorln("Unable to find command for task", taskId)
 		driver.Abort()
+		return
 	}
 	if c.Status.GetState() == status.GetState() {
 		// ignore repeated status updates
 		return
 	}
+	if c.HasEnded() {
+		// e.g. the real state of a task the reconciler reported as lost
+		log.Infof("Ignoring state %s of task %s, which already ended with %s\n", status.GetState(), taskId, c.Status.GetState())
+		if !IsEndState(status.GetState()) {
+			// it may have been retried already, so it must not keep running
+			log.Infoln("Killing task", taskId)
+			driver.KillTask(util.NewTaskID(taskId))
+		}
+		return
+	}
 	c.Status = status
 
 	// send status update to CommandHandler
 	if status.GetState() == mesos.TaskState_TASK_RUNNING {
 		sched.handler.CommandRunning(c)
+		c.StartTimer(func() {
+			log.Infof("Task %s exceeded timeout of %s, killing it\n", c.Id, c.Timeout)
+			driver.KillTask(util.NewTaskID(c.Id))
+		})
 	} else if status.GetState() == mesos.TaskState_TASK_FINISHED {
 		sched.handler.CommandEnded(c)
 		sched.handler.CommandFinished(c)
-	} else if status.GetState() == mesos.TaskState_TASK_FAILED ||
-		status.GetState() == mesos.TaskState_TASK_LOST ||
-		status.GetState() == mesos.TaskState_TASK_KILLED {
+	} else if c.HasEnded() {
+		// failed, lost, killed or rejected by the master, the latter is never retried
 		sched.handler.CommandEnded(c)
-		sched.handler.CommandFailed(c)
+		if status.GetState() == mesos.TaskState_TASK_KILLED && c.IsTimedOut() {
+			sched.handler.CommandTimedOut(c)
+		} else if !sched.shutdown && sched.retry.ShouldRetry(c) {
+			sched.retryCommand(c)
+		} else {
+			sched.handler.CommandFailed(c)
+		}
 	}
 
 	// stop if Commands channel was closed and all tasks are finished
 	if sched.queue.Closed() && !sched.handler.HasRunningTasks() {
 		log.Infoln("All tasks finished, stopping framework.")
-		sched.handler.FinishAllCommands()
-		driver.Stop(false)
+		sched.stop(driver)
+	} else if sched.allFetched() {
+		sched.stopArtifactServer()
 	}
 }
 
+// stop launching commands and kill all tasks
+// the framework is stopped once all tasks ended
+func (sched *NoneScheduler) Shutdown(driver sched.SchedulerDriver) {
+	sched.mutex <- true
+	defer func() { <-sched.mutex }()
+
+	sched.shutdown = true
+	sched.queue.Stop()
+
+	active := sched.handler.ActiveCommands()
+	if len(active) == 0 {
+		log.Infoln("No tasks running, stopping framework.")
+		sched.stop(driver)
+		return
+	}
+	for _, c := range active {
+		log.Infoln("Killing task", c.Id)
+		driver.KillTask(util.NewTaskID(c.Id))
+	}
+}
+
+// checks if Shutdown() was called
+func (sched *NoneScheduler) IsShutdown() bool {
+	sched.mutex <- true
+	defer func() { <-sched.mutex }()
+	return sched.shutdown
+}
+
 func (sched *NoneScheduler) OfferRescinded(driver sched.SchedulerDriver, offer *mesos.OfferID) {
 	log.Infoln("Rescined offer", *offer)
 }
@@ -136,15 +270,135 @@ func (sched *NoneScheduler) Error(driver sched.SchedulerDriver, err string) {
 
 // private
 
+// mark unconfirmed tasks as lost, kill them and request reconciliation for all running tasks
+func (sched *NoneScheduler) reconcile(driver sched.SchedulerDriver) {
+	for _, id := range sched.reconciler.Expired() {
+		c := sched.queue.GetCommandById(id)
+		if c == nil || c.HasEnded() {
+			continue
+		}
+		log.Infoln("Unable to reconcile task", id, ", marking it as lost and killing it")
+		// the task may still be running on a slave the master lost contact with
+		driver.KillTask(util.NewTaskID(id))
+		status := util.NewTaskStatus(util.NewTaskID(id), mesos.TaskState_TASK_LOST)
+		status.Reason = mesos.TaskStatus_REASON_RECONCILIATION.Enum()
+		status.Message = proto.String("Task state could not be reconciled")
+		sched.statusUpdate(driver, status)
+	}
+	sched.reconciler.Reconcile(driver, sched.handler.ActiveCommands())
+}
+
+// saves pending, running and failed commands
+func (sched *NoneScheduler) checkpoint() {
+	if sched.store == nil {
+		return
+	}
+	state := &State{FrameworkId: sched.frameworkId, Commands: []*CommandState{}}
+	for _, c := range sched.queue.Commands() {
+		pending := c.SlaveId == "" && c.Status == nil
+		running := c.SlaveId != "" && !c.HasEnded()
+		failed := c.HasEnded() && c.ExitCode != 0
+		if pending || running || failed {
+			state.Commands = append(state.Commands, NewCommandState(c))
+		}
+	}
+	if err := sched.store.Save(state); err != nil {
+		log.Errorln("Unable to save state:", err)
+	}
+}
+
+// checks if all commands fetched their artifacts and no command is going to be launched anymore
+// a lost task may be retried, so artifacts are kept while retries are enabled
+func (sched *NoneScheduler) allFetched() bool {
+	if sched.retry.MaxRetries > 0 || sched.queue.GetCommand() != nil || !sched.queue.Closed() {
+		return false
+	}
+	for _, c := range sched.handler.ActiveCommands() {
+		if c.Status.GetState() != mesos.TaskState_TASK_RUNNING {
+			return false
+		}
+	}
+	return true
+}
+
+func (sched *NoneScheduler) stopArtifactServer() {
+	if sched.artifacts == nil {
+		return
+	}
+	// running downloads would block the scheduler
+	go sched.artifacts.Stop()
+	sched.artifacts = nil
+}
+
+// wait for pending output and stop the framework
+func (sched *NoneScheduler) stop(driver sched.SchedulerDriver) {
+	sched.stopArtifactServer()
+	sched.handler.FinishAllCommands()
+	// nothing left to resume
+	sched.store = nil
+	driver.Stop(false)
+}
+
+// constraints are checked for each command as they may depend on already placed commands
+// launches the first pending command fitting any of the offers
+// returns false if none fits
+func (sched *NoneScheduler) placeCommand(slots []*OfferSlot) bool {
+	for _, c := range sched.queue.Pending(sched.lookahead) {
+		candidates := []*OfferSlot{}
+		for _, slot := range slots {
+			if slot.Remaining.Contain(c) && sched.matchesConstraints(slot.Offer, c) {
+				candidates = append(candidates, slot)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		if c != sched.queue.GetCommand() {
+			log.Infof("Launching task %s ahead of task %s, which doesn't fit any offer\n", c.Id, sched.queue.GetCommand().Id)
+		}
+
+		slot := sched.placement.Select(c, candidates, sched.handler.ActiveCommands())
+		offer := slot.Offer
+		c.SlaveId = offer.SlaveId.GetValue()
+		c.Hostname = offer.GetHostname()
+		c.Attributes = offer.GetAttributes()
+		c.FrameworkId = sched.frameworkId
+		c.Allocated = slot.Remaining.Allocate(c)
+		c.AllocatedPorts = RangeValues(c.Allocated, RESOURCE_PORTS)
+		sched.handler.CommandLaunched(c)
+		slot.Tasks = append(slot.Tasks, sched.prepareTaskInfo(offer, c))
+		sched.queue.Take(c)
+		return true
+	}
+	return false
+}
+
+// the command's own constraints overrule -constraints
+func (sched *NoneScheduler) matchesConstraints(offer *mesos.Offer, c *Command) bool {
+	placed := sched.handler.ActiveCommands()
+	if c.Constraints != nil {
+		return c.MatchesConstraints(offer, placed)
+	}
+	return sched.filter.FilterOffer(offer, placed)
+}
+
+// launch the command again after backoff
+func (sched *NoneScheduler) retryCommand(c *Command) {
+	r := c.NewAttempt()
+	delay := sched.retry.Delay(c)
+	sched.queue.Requeue(r, delay)
+	log.Infof("Retrying task %s as task %s in %s\n", c.Id, r.Id, delay)
+	sched.handler.CommandRetried(c, r, sched.retry.MaxRetries)
+}
+
 func (sched *NoneScheduler) prepareTaskInfo(offer *mesos.Offer, c *Command) *mesos.TaskInfo {
 	sched.tasksLaunched++
 
 	task := &mesos.TaskInfo{
-		Name:    proto.String("none-task-" + c.Id),
-		TaskId:  util.NewTaskID(c.Id),
-		SlaveId: offer.SlaveId,
-		Command: c.GetCommandInfo(),
-		// TODO: add role to resource allocation?
+		Name:      proto.String(c.GetName()),
+		TaskId:    util.NewTaskID(c.Id),
+		SlaveId:   offer.SlaveId,
+		Command:   c.GetCommandInfo(),
 		Resources: c.GetResources(),
 		Container: c.ContainerInfo,
 	}
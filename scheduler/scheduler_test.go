@@ -0,0 +1,472 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// mocks
+
+type MockSchedulerDriver struct {
+	mock.Mock
+}
+
+func (m *MockSchedulerDriver) Start() (mesos.Status, error) {
+	args := m.Called()
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) Stop(failover bool) (mesos.Status, error) {
+	args := m.Called(failover)
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) Abort() (mesos.Status, error) {
+	args := m.Called()
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) Join() (mesos.Status, error) {
+	args := m.Called()
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) Run() (mesos.Status, error) {
+	args := m.Called()
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) RequestResources(requests []*mesos.Request) (mesos.Status, error) {
+	args := m.Called(requests)
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) LaunchTasks(offerIDs []*mesos.OfferID, tasks []*mesos.TaskInfo, filters *mesos.Filters) (mesos.Status, error) {
+	args := m.Called(offerIDs, tasks, filters)
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) KillTask(taskID *mesos.TaskID) (mesos.Status, error) {
+	args := m.Called(taskID)
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) DeclineOffer(offerID *mesos.OfferID, filters *mesos.Filters) (mesos.Status, error) {
+	args := m.Called(offerID, filters)
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) ReviveOffers() (mesos.Status, error) {
+	args := m.Called()
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) SendFrameworkMessage(executorID *mesos.ExecutorID, slaveID *mesos.SlaveID, data string) (mesos.Status, error) {
+	args := m.Called(executorID, slaveID, data)
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func (m *MockSchedulerDriver) ReconcileTasks(statuses []*mesos.TaskStatus) (mesos.Status, error) {
+	args := m.Called(statuses)
+	return args.Get(0).(mesos.Status), args.Error(1)
+}
+
+func newTestScheduler(cmdq CommandQueuer, retry *RetryPolicy) *NoneScheduler {
+	return NewNoneScheduler(cmdq, NewCommandHandler(), &ResourceFilter{Constraints: Constraints{}}, retry, NewReconciler(time.Minute))
+}
+
+func newTestOffer(id string, cpus, mem float64) *mesos.Offer {
+	o := util.NewOffer(util.NewOfferID(id), util.NewFrameworkID("framework"), util.NewSlaveID("slave-"+id), "host-"+id)
+	o.Resources = []*mesos.Resource{
+		util.NewScalarResource("cpus", cpus),
+		util.NewScalarResource("mem", mem),
+	}
+	return o
+}
+
+// tests
+
+func TestResourceOffersDeclinesWithoutCommands(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	o := newTestOffer("1", 1, 128)
+
+	d := &MockSchedulerDriver{}
+	d.On("DeclineOffer", o.Id, mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	s.ResourceOffers(d, []*mesos.Offer{o})
+	d.AssertExpectations(t)
+}
+
+func TestResourceOffersLaunchesCommands(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	c0 := &Command{Cmd: "foo", CpuReq: 1, MemReq: 128}
+	c1 := &Command{Cmd: "bar", CpuReq: 1, MemReq: 128}
+	c2 := &Command{Cmd: "baz", CpuReq: 1, MemReq: 128}
+	cq.Enqueue(c0)
+	cq.Enqueue(c1)
+	cq.Enqueue(c2)
+
+	o := newTestOffer("1", 2, 512)
+	d := &MockSchedulerDriver{}
+	d.On("LaunchTasks", []*mesos.OfferID{o.Id}, mock.Anything, mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	s.ResourceOffers(d, []*mesos.Offer{o})
+	d.AssertExpectations(t)
+
+	tasks := d.Calls[0].Arguments.Get(1).([]*mesos.TaskInfo)
+	assert.Equal(t, 2, len(tasks))
+	assert.Equal(t, "slave-1", c0.SlaveId)
+	assert.Equal(t, "host-1", c1.Hostname)
+	assert.Equal(t, c2, cq.GetCommand(), "command should be kept for the next offer")
+	assert.Equal(t, 2, len(s.handler.ActiveCommands()))
+}
+
+func TestResourceOffersAllocatesPorts(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	c0 := &Command{Cmd: "foo", CpuReq: 1, MemReq: 128, Ports: 2}
+	c1 := &Command{Cmd: "bar", CpuReq: 1, MemReq: 128, Ports: 2}
+	cq.Enqueue(c0)
+	cq.Enqueue(c1)
+
+	o := newTestOffer("1", 2, 512)
+	o.Resources = append(o.Resources, util.NewRangesResource("ports", []*mesos.Value_Range{util.NewValueRange(31000, 31002)}))
+	d := &MockSchedulerDriver{}
+	d.On("LaunchTasks", []*mesos.OfferID{o.Id}, mock.Anything, mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	s.ResourceOffers(d, []*mesos.Offer{o})
+	d.AssertExpectations(t)
+
+	tasks := d.Calls[0].Arguments.Get(1).([]*mesos.TaskInfo)
+	assert.Equal(t, 1, len(tasks), "ports should suffice for a single task")
+	assert.Equal(t, []uint64{31000, 31001}, c0.AllocatedPorts)
+	assert.Equal(t, c1, cq.GetCommand())
+}
+
+func TestResourceOffersAnnotatesRoles(t *testing.T) {
+	cq := NewCommandQueue()
+	role := "batch"
+	s := NewNoneScheduler(cq, NewCommandHandler(), &ResourceFilter{Constraints: Constraints{}, Role: &role}, NewRetryPolicy(0, 0, false), NewReconciler(time.Minute))
+	c := &Command{Cmd: "foo", CpuReq: 2, MemReq: 128}
+	cq.Enqueue(c)
+
+	o := newTestOffer("1", 1, 512)
+	cpus := util.NewScalarResource("cpus", 1)
+	cpus.Role = proto.String(role)
+	other := util.NewScalarResource("cpus", 4)
+	other.Role = proto.String("other")
+	o.Resources = append(o.Resources, cpus, other)
+	d := &MockSchedulerDriver{}
+	d.On("LaunchTasks", []*mesos.OfferID{o.Id}, mock.Anything, mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	s.ResourceOffers(d, []*mesos.Offer{o})
+	d.AssertExpectations(t)
+
+	tasks := d.Calls[0].Arguments.Get(1).([]*mesos.TaskInfo)
+	assert.Equal(t, 1, len(tasks))
+	res := tasks[0].GetResources()
+	assert.Equal(t, 3, len(res))
+	assert.Equal(t, role, res[0].GetRole(), "reserved cpus should be used first")
+	assert.Equal(t, 1.0, res[0].GetScalar().GetValue())
+	assert.Equal(t, "*", res[1].GetRole())
+	assert.Equal(t, 1.0, res[1].GetScalar().GetValue())
+	assert.Equal(t, "mem", res[2].GetName())
+}
+
+func TestResourceOffersSkipsCommandsNotFitting(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	big := &Command{Cmd: "big", CpuReq: 4, MemReq: 128}
+	small := &Command{Cmd: "small", CpuReq: 1, MemReq: 128}
+	cq.Enqueue(big)
+	cq.Enqueue(small)
+
+	o := newTestOffer("1", 2, 512)
+	d := &MockSchedulerDriver{}
+	d.On("LaunchTasks", []*mesos.OfferID{o.Id}, mock.Anything, mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	s.ResourceOffers(d, []*mesos.Offer{o})
+	assert.Empty(t, d.Calls[0].Arguments.Get(1), "big should block small without lookahead")
+
+	s.SetPlacement(&FirstFitPlacement{}, 2)
+	s.ResourceOffers(d, []*mesos.Offer{o})
+	tasks := d.Calls[1].Arguments.Get(1).([]*mesos.TaskInfo)
+	assert.Equal(t, 1, len(tasks))
+	assert.Equal(t, small.Id, tasks[0].TaskId.GetValue())
+	assert.Equal(t, big, cq.GetCommand(), "big should stay at the head of the queue")
+}
+
+func TestStatusUpdateWaitsForCommandsNotFitting(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	s.SetPlacement(&FirstFitPlacement{}, 2)
+	big := &Command{Cmd: "big", CpuReq: 4, MemReq: 128}
+	small := &Command{Cmd: "small", CpuReq: 1, MemReq: 128}
+	cq.Enqueue(big)
+	cq.Enqueue(small)
+	cq.Close()
+
+	o := newTestOffer("1", 2, 512)
+	d := &MockSchedulerDriver{}
+	d.On("LaunchTasks", []*mesos.OfferID{o.Id}, mock.Anything, mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+	s.ResourceOffers(d, []*mesos.Offer{o})
+	assert.Equal(t, 1, len(d.Calls[0].Arguments.Get(1).([]*mesos.TaskInfo)))
+
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(small.Id), mesos.TaskState_TASK_FINISHED))
+	d.AssertNotCalled(t, "Stop", mock.Anything)
+	assert.False(t, cq.Closed(), "big was not launched yet")
+	assert.Equal(t, big, cq.GetCommand())
+}
+
+func TestResourceOffersSpreadsCommands(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	s.SetPlacement(&SpreadPlacement{}, 1)
+	for i := 0; i < 4; i++ {
+		cq.Enqueue(&Command{Cmd: "foo", CpuReq: 1, MemReq: 128})
+	}
+
+	o1 := newTestOffer("1", 4, 512)
+	o2 := newTestOffer("2", 4, 512)
+	d := &MockSchedulerDriver{}
+	d.On("LaunchTasks", mock.Anything, mock.Anything, mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	s.ResourceOffers(d, []*mesos.Offer{o1, o2})
+	assert.Equal(t, 2, len(d.Calls[0].Arguments.Get(1).([]*mesos.TaskInfo)))
+	assert.Equal(t, 2, len(d.Calls[1].Arguments.Get(1).([]*mesos.TaskInfo)))
+}
+
+func TestResourceOffersCommandConstraintsOverrule(t *testing.T) {
+	cq := NewCommandQueue()
+	global := new(MockConstraint)
+	global.On("Match", mock.Anything, mock.Anything).Return(false)
+	s := NewNoneScheduler(cq, NewCommandHandler(), &ResourceFilter{Constraints: global}, NewRetryPolicy(0, 0, false), NewReconciler(time.Minute))
+	own := new(MockConstraint)
+	own.On("Match", mock.Anything, mock.Anything).Return(true)
+	c := &Command{Cmd: "foo", CpuReq: 1, MemReq: 128, Constraints: own}
+	cq.Enqueue(c)
+
+	o := newTestOffer("1", 1, 128)
+	d := &MockSchedulerDriver{}
+	d.On("LaunchTasks", []*mesos.OfferID{o.Id}, mock.Anything, mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	s.ResourceOffers(d, []*mesos.Offer{o})
+	assert.Equal(t, 1, len(d.Calls[0].Arguments.Get(1).([]*mesos.TaskInfo)))
+	global.AssertNotCalled(t, "Match", mock.Anything, mock.Anything)
+}
+
+func TestStatusUpdateIgnoresEndedTask(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	c0 := &Command{Cmd: "foo"}
+	c1 := &Command{Cmd: "bar"}
+	cq.Enqueue(c0)
+	cq.Enqueue(c1)
+	cq.Close()
+	for _, c := range []*Command{c0, c1} {
+		cq.Take(cq.GetCommand())
+		s.handler.CommandLaunched(c)
+	}
+
+	d := &MockSchedulerDriver{}
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(c0.Id), mesos.TaskState_TASK_LOST))
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(c0.Id), mesos.TaskState_TASK_FAILED))
+
+	assert.Equal(t, mesos.TaskState_TASK_LOST, c0.Status.GetState())
+	assert.True(t, s.handler.HasRunningTasks(), "c1 should still be running")
+	assert.Equal(t, 1, s.handler.ExitCode(EXIT_CODE_MODE_COUNT))
+	d.AssertNotCalled(t, "Stop", mock.Anything)
+}
+
+func TestStatusUpdateRetriesLostTask(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(1, 0, false))
+	c := &Command{Cmd: "foo"}
+	cq.Enqueue(c)
+	cq.Close()
+	assert.Equal(t, c, cq.Next())
+	s.handler.CommandLaunched(c)
+
+	d := &MockSchedulerDriver{}
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(c.Id), mesos.TaskState_TASK_LOST))
+	d.AssertNotCalled(t, "Stop", mock.Anything)
+
+	assert.False(t, s.handler.HasFailures())
+	assert.False(t, cq.Closed(), "retry should be pending")
+}
+
+func TestStatusUpdateFailsRejectedTask(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(1, 0, true))
+	c := &Command{Cmd: "foo"}
+	cq.Enqueue(c)
+	cq.Close()
+	assert.Equal(t, c, cq.Next())
+	assert.Nil(t, cq.Next())
+	s.handler.CommandLaunched(c)
+
+	d := &MockSchedulerDriver{}
+	d.On("Stop", false).Return(mesos.Status_DRIVER_STOPPED, nil)
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(c.Id), mesos.TaskState_TASK_ERROR))
+	d.AssertCalled(t, "Stop", false)
+
+	assert.True(t, c.HasEnded())
+	assert.True(t, s.handler.HasFailures())
+	assert.True(t, cq.Closed(), "rejected tasks should not be retried")
+}
+
+func TestShutdownWithoutTasks(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	cq.Enqueue(&Command{})
+
+	d := &MockSchedulerDriver{}
+	d.On("Stop", false).Return(mesos.Status_DRIVER_STOPPED, nil)
+
+	s.Shutdown(d)
+	d.AssertExpectations(t)
+	assert.True(t, s.IsShutdown())
+	assert.True(t, cq.Closed())
+	assert.Nil(t, cq.GetCommand())
+}
+
+func TestShutdownKillsTasks(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(3, 0, false))
+	c0 := &Command{}
+	c1 := &Command{}
+	cq.Enqueue(c0)
+	cq.Enqueue(c1)
+	cq.Next()
+	s.handler.CommandLaunched(c0)
+
+	d := &MockSchedulerDriver{}
+	d.On("KillTask", util.NewTaskID(c0.Id)).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	s.Shutdown(d)
+	d.AssertExpectations(t)
+	d.AssertNotCalled(t, "Stop", mock.Anything)
+
+	d.On("Stop", false).Return(mesos.Status_DRIVER_STOPPED, nil)
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(c0.Id), mesos.TaskState_TASK_LOST))
+	d.AssertExpectations(t)
+	assert.True(t, s.handler.HasFailures(), "lost task should not be retried after shutdown")
+}
+
+func TestReregisteredMarksUnconfirmedTasksLost(t *testing.T) {
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(1, 0, false))
+	s.reconciler.Timeout = time.Millisecond
+	c := &Command{Cmd: "foo"}
+	cq.Enqueue(c)
+	cq.Close()
+	cq.Next()
+	s.handler.CommandLaunched(c)
+
+	d := &MockSchedulerDriver{}
+	d.On("ReconcileTasks", mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+
+	s.Reregistered(d, nil)
+	d.AssertNumberOfCalls(t, "ReconcileTasks", 2)
+	assert.Nil(t, c.Status)
+
+	time.Sleep(5 * time.Millisecond)
+	d.On("KillTask", util.NewTaskID(c.Id)).Return(mesos.Status_DRIVER_RUNNING, nil)
+	s.Reregistered(d, nil)
+	d.AssertNumberOfCalls(t, "KillTask", 1)
+	assert.Equal(t, mesos.TaskState_TASK_LOST, c.Status.GetState())
+	assert.Equal(t, mesos.TaskStatus_REASON_RECONCILIATION, c.Status.GetReason())
+	assert.False(t, cq.Closed(), "lost task should be retried")
+
+	// the task turns up again after it was retried
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(c.Id), mesos.TaskState_TASK_RUNNING))
+	d.AssertNumberOfCalls(t, "KillTask", 2)
+	assert.Equal(t, mesos.TaskState_TASK_LOST, c.Status.GetState())
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(c.Id), mesos.TaskState_TASK_KILLED))
+	d.AssertNumberOfCalls(t, "KillTask", 2)
+}
+
+func TestCheckpointAndRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "none-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := NewStateFile(filepath.Join(dir, "state.json"))
+
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	s.StartCheckpointing(store, time.Hour)
+	running := &Command{Cmd: "foo", CpuReq: 1, MemReq: 128}
+	failed := &Command{Cmd: "bar", CpuReq: 1, MemReq: 128}
+	pending := &Command{Cmd: "baz", CpuReq: 1, MemReq: 128}
+	cq.Enqueue(running)
+	cq.Enqueue(failed)
+	cq.Enqueue(pending)
+
+	d := &MockSchedulerDriver{}
+	d.On("LaunchTasks", mock.Anything, mock.Anything, mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+	d.On("ReconcileTasks", mock.Anything).Return(mesos.Status_DRIVER_RUNNING, nil)
+	s.Registered(d, util.NewFrameworkID("framework"), nil)
+	s.ResourceOffers(d, []*mesos.Offer{newTestOffer("1", 2, 256)})
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(failed.Id), mesos.TaskState_TASK_LOST))
+
+	state, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "framework", state.FrameworkId)
+	assert.Equal(t, 3, len(state.Commands))
+
+	commands, err := state.GetCommands()
+	assert.NoError(t, err)
+	rq := NewCommandQueue()
+	r := newTestScheduler(rq, NewRetryPolicy(0, 0, false))
+	r.Restore(state.FrameworkId, commands)
+	rq.Close()
+
+	assert.Equal(t, 1, len(r.handler.ActiveCommands()))
+	assert.Equal(t, running.Id, r.handler.ActiveCommands()[0].Id)
+	assert.Equal(t, pending.Id, rq.GetCommand().Id)
+	assert.Equal(t, EXIT_CODE_FAILURE, r.handler.ExitCode(EXIT_CODE_MODE_MAX))
+}
+
+func TestArtifactServerStopsOnceAllTasksRun(t *testing.T) {
+	server, _ := NewArtifactServer("127.0.0.1", 0, nil)
+	assert.Nil(t, server.Start())
+	uri := server.Serve("scheduler_test.go", "workdir.tar.gz")
+
+	cq := NewCommandQueue()
+	s := newTestScheduler(cq, NewRetryPolicy(0, 0, false))
+	s.SetArtifactServer(server)
+	c0 := &Command{}
+	c1 := &Command{}
+	cq.Enqueue(c0)
+	cq.Enqueue(c1)
+	cq.Close()
+	assert.Equal(t, c0, cq.Next())
+	s.handler.CommandLaunched(c0)
+	assert.Equal(t, c1, cq.Next())
+	s.handler.CommandLaunched(c1)
+	assert.Nil(t, cq.Next())
+
+	d := &MockSchedulerDriver{}
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(c0.Id), mesos.TaskState_TASK_RUNNING))
+	resp, err := http.Get(uri)
+	assert.Nil(t, err, "task 1 did not fetch its artifacts yet")
+	resp.Body.Close()
+
+	s.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(c1.Id), mesos.TaskState_TASK_RUNNING))
+	assert.Eventually(t, func() bool {
+		_, err := http.Get(uri)
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+)
+
+const (
+	DEFAULT_FAILOVER_TIMEOUT  = 1 * time.Hour
+	STATE_CHECKPOINT_INTERVAL = 5 * time.Second
+)
+
+// persists the state of a run
+type StateStore interface {
+	// returns nil if no state was saved yet
+	Load() (*State, error)
+	Save(*State) error
+	// the run is complete, there is nothing left to resume
+	Complete() error
+}
+
+// everything needed to resume a run after the scheduler died
+type State struct {
+	FrameworkId string          `json:"framework_id"`
+	Commands    []*CommandState `json:"commands"`
+	Complete    bool            `json:"complete,omitempty"`
+}
+
+// a pending, running or failed command
+type CommandState struct {
+	Id           string               `json:"id"`
+	Cmd          string               `json:"cmd"`
+	Name         string               `json:"name,omitempty"`
+	Cpus         float64              `json:"cpus"`
+	Mem          float64              `json:"mem"`
+	Disk         float64              `json:"disk,omitempty"`
+	Resources    map[string]float64   `json:"resources,omitempty"`
+	Ports        int                  `json:"ports,omitempty"`
+	Env          map[string]string    `json:"env,omitempty"`
+	Constraints  string               `json:"constraints,omitempty"`
+	Timeout      time.Duration        `json:"timeout,omitempty"`
+	Container    *mesos.ContainerInfo `json:"container,omitempty"`
+	Attempt      int                  `json:"attempt,omitempty"`
+	SlaveId      string               `json:"slave_id,omitempty"`
+	Hostname     string               `json:"hostname,omitempty"`
+	Attributes   []*mesos.Attribute   `json:"attributes,omitempty"`
+	State        string               `json:"state,omitempty"`
+	ExitCode     int                  `json:"exit_code,omitempty"`
+	SlaveUrl     string               `json:"slave_url,omitempty"`
+	Directory    string               `json:"directory,omitempty"`
+	StdoutOffset int                  `json:"stdout_offset,omitempty"`
+	StderrOffset int                  `json:"stderr_offset,omitempty"`
+}
+
+func NewCommandState(c *Command) *CommandState {
+	s := &CommandState{
+		Id:         c.Id,
+		Cmd:        c.Cmd,
+		Name:       c.Name,
+		Cpus:       c.CpuReq,
+		Mem:        c.MemReq,
+		Disk:       c.DiskReq,
+		Resources:  c.Resources,
+		Ports:      c.Ports,
+		Env:        c.Env,
+		Timeout:    c.Timeout,
+		Container:  c.ContainerInfo,
+		Attempt:    c.Attempt,
+		SlaveId:    c.SlaveId,
+		Hostname:   c.Hostname,
+		Attributes: c.Attributes,
+		ExitCode:   c.ExitCode,
+		SlaveUrl:   c.SlaveUrl,
+		Directory:  c.Directory,
+	}
+	if c.Constraints != nil {
+		s.Constraints = fmt.Sprint(c.Constraints)
+	}
+	if c.Status != nil {
+		s.State = c.Status.GetState().String()
+	}
+	s.StdoutOffset, s.StderrOffset = c.OutputOffsets()
+	return s
+}
+
+// recreates the command, running tasks get no status to pick up the first status update after resuming
+func (s *CommandState) Command(frameworkId string) (*Command, error) {
+	c := &Command{
+		Id:            s.Id,
+		Cmd:           s.Cmd,
+		Name:          s.Name,
+		CpuReq:        s.Cpus,
+		MemReq:        s.Mem,
+		DiskReq:       s.Disk,
+		Resources:     s.Resources,
+		Ports:         s.Ports,
+		Env:           s.Env,
+		Timeout:       s.Timeout,
+		ContainerInfo: s.Container,
+		Attempt:       s.Attempt,
+		SlaveId:       s.SlaveId,
+		Hostname:      s.Hostname,
+		Attributes:    s.Attributes,
+		ExitCode:      s.ExitCode,
+		SlaveUrl:      s.SlaveUrl,
+		Directory:     s.Directory,
+	}
+	if s.Constraints != "" {
+		cs, err := ParseConstraints(&s.Constraints)
+		if err != nil {
+			return nil, err
+		}
+		c.Constraints = cs
+	}
+	if c.SlaveId != "" {
+		c.FrameworkId = frameworkId
+	}
+	if s.State != "" {
+		state, ok := mesos.TaskState_value[s.State]
+		if !ok {
+			return nil, fmt.Errorf("Unknown state %s of task %s", s.State, s.Id)
+		}
+		c.Status = util.NewTaskStatus(util.NewTaskID(s.Id), mesos.TaskState(state))
+		if !c.HasEnded() {
+			c.Status = nil
+		}
+	}
+	c.SetOutputOffsets(s.StdoutOffset, s.StderrOffset)
+	return c, nil
+}
+
+// recreates all commands of the run
+func (s *State) GetCommands() ([]*Command, error) {
+	commands := []*Command{}
+	for _, cs := range s.Commands {
+		c, err := cs.Command(s.FrameworkId)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, c)
+	}
+	return commands, nil
+}
+
+// stores the state as JSON in a local file
+type StateFile struct {
+	Path string
+}
+
+func NewStateFile(path string) *StateFile {
+	return &StateFile{Path: path}
+}
+
+func (f *StateFile) Load() (*State, error) {
+	data, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("Invalid state file %s: %s", f.Path, err)
+	}
+	return &state, nil
+}
+
+// writes a temporary file first, so a crash never leaves a truncated state behind
+func (f *StateFile) Save(state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+// removes the file
+func (f *StateFile) Complete() error {
+	return os.Remove(f.Path)
+}
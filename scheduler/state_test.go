@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandStateRoundTrip(t *testing.T) {
+	expr := "rack:EQUALS:a | !hostname:UNIQUE"
+	cs, err := ParseConstraints(&expr)
+	assert.NoError(t, err)
+	c := &Command{
+		Id:          "7",
+		Cmd:         "echo foo",
+		CpuReq:      2,
+		MemReq:      256,
+		Env:         map[string]string{"FOO": "bar"},
+		Constraints: cs,
+		Timeout:     time.Minute,
+		Attempt:     1,
+		SlaveId:     "slave-1",
+		Status:      util.NewTaskStatus(util.NewTaskID("7"), mesos.TaskState_TASK_RUNNING),
+	}
+	c.SetOutputOffsets(10, 20)
+
+	r, err := NewCommandState(c).Command("framework")
+	assert.NoError(t, err)
+	assert.Equal(t, "echo foo", r.Cmd)
+	assert.Equal(t, 256.0, r.MemReq)
+	assert.Equal(t, "bar", r.Env["FOO"])
+	assert.Equal(t, time.Minute, r.Timeout)
+	assert.Equal(t, 1, r.Attempt)
+	assert.Equal(t, "framework", r.FrameworkId)
+	assert.Equal(t, cs.String(), r.Constraints.(Constraints).String())
+	assert.Nil(t, r.Status, "running task should wait for its first status update")
+	stdout, stderr := r.OutputOffsets()
+	assert.Equal(t, 10, stdout)
+	assert.Equal(t, 20, stderr)
+}
+
+func TestCommandStateRoundTripQuotesValues(t *testing.T) {
+	expr := `rack:LIKE:'rack-(1|2)!&;' & !zone:UNLIKE:"it's" | host:EQUALS:' a b '`
+	cs, err := ParseConstraints(&expr)
+	assert.NoError(t, err)
+
+	r, err := NewCommandState(&Command{Id: "1", Constraints: cs}).Command("framework")
+	assert.NoError(t, err)
+	assert.Equal(t, cs, r.Constraints)
+}
+
+func TestCommandStateRoundTripKeepsTrailingSpace(t *testing.T) {
+	cs := Constraints{&EqualsConstraint{Attribute: "host", Value: "a "}}
+
+	r, err := NewCommandState(&Command{Id: "1", Constraints: cs}).Command("framework")
+	assert.NoError(t, err)
+	assert.Equal(t, cs, r.Constraints)
+}
+
+func TestCommandStateKeepsEndedStatus(t *testing.T) {
+	s := &CommandState{Id: "1", SlaveId: "slave-1", State: "TASK_FAILED", ExitCode: 3}
+	c, err := s.Command("framework")
+	assert.NoError(t, err)
+	assert.True(t, c.HasEnded())
+	assert.Equal(t, 3, c.ExitCode)
+
+	s.State = "TASK_UNKNOWN_STATE"
+	_, err = s.Command("framework")
+	assert.Error(t, err)
+}
+
+func TestStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "none-state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	f := NewStateFile(filepath.Join(dir, "state.json"))
+	loaded, err := f.Load()
+	assert.NoError(t, err)
+	assert.Nil(t, loaded)
+
+	state := &State{FrameworkId: "framework", Commands: []*CommandState{{Id: "1", Cmd: "ls"}}}
+	assert.NoError(t, f.Save(state))
+	loaded, err = f.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, state, loaded)
+
+	assert.NoError(t, f.Complete())
+	_, err = os.Stat(f.Path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ignore files read from the workdir and its subdirectories, later rules win
+var WORKDIR_IGNORE_FILES = []string{".gitignore", ".noneignore"}
+
+// number of archives kept in the cache, older ones are removed
+const WORKDIR_CACHE_SIZE = 3
+
+// a directory of the current user, the artifact secret kept there must not be shared with others
+func DefaultWorkdirCache() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "none", "workdir")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("none-workdir-cache-%d", os.Getuid()))
+}
+
+// ------ ignore rules --- //
+
+// gitignore-style rules for excluding files from the workdir archive
+type Ignore struct {
+	rules []*ignoreRule
+}
+
+type ignoreRule struct {
+	// slash separated directory of the ignore file, rules only apply below it
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// reads the ignore files in dir, .git is always ignored
+func NewIgnore(dir string) (*Ignore, error) {
+	i := &Ignore{}
+	i.Add(".git/")
+	return i, i.ReadDir(dir, "")
+}
+
+// reads the ignore files in the workdir's subdirectory dir, rel is its slash separated path
+func (i *Ignore) ReadDir(dir, rel string) error {
+	for _, name := range WORKDIR_IGNORE_FILES {
+		f, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			i.add(s.Text(), rel)
+		}
+		f.Close()
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adds a single line of an ignore file
+func (i *Ignore) Add(line string) {
+	i.add(line, "")
+}
+
+// checks if the slash separated path rel is ignored
+func (i *Ignore) Match(rel string, dir bool) bool {
+	ignored := false
+	for _, r := range i.rules {
+		if !dir && r.dirOnly {
+			continue
+		}
+		p := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			p = rel[len(r.base)+1:]
+		}
+		if r.re.MatchString(p) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func (i *Ignore) add(line, base string) {
+	line = strings.TrimRight(line, " ")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	r := &ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// patterns without / match at any level
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	expr := ignorePatternToRegexp(line)
+	if !anchored {
+		expr = "(.*/)?" + expr
+	}
+	if re, err := regexp.Compile("^" + expr + "$"); err == nil {
+		r.re = re
+		i.rules = append(i.rules, r)
+	}
+}
+
+func ignorePatternToRegexp(pattern string) string {
+	expr := ""
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr += "(.*/)?"
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr += ".*"
+			i++
+		case c == '*':
+			expr += "[^/]*"
+		case c == '?':
+			expr += "[^/]"
+		case c == '[':
+			if j := strings.Index(pattern[i:], "]"); j > 0 {
+				expr += strings.Replace(pattern[i:i+j+1], "[!", "[^", 1)
+				i += j
+			} else {
+				expr += regexp.QuoteMeta("[")
+			}
+		default:
+			expr += regexp.QuoteMeta(string(c))
+		}
+	}
+	return expr
+}
+
+// ------ archive --- //
+
+// a file of the workdir to archive
+type workdirFile struct {
+	path string
+	rel  string
+	info os.FileInfo
+	link string
+}
+
+// archives all files of dir not ignored to cacheDir
+// the archive is named after the hash of its content and reused while nothing changes
+// returns the path of the archive
+func ArchiveWorkdir(dir, cacheDir string) (string, error) {
+	ignore, err := NewIgnore(dir)
+	if err != nil {
+		return "", err
+	}
+	files, err := listWorkdir(dir, ignore)
+	if err != nil {
+		return "", err
+	}
+	hash, err := hashWorkdir(files)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(cacheDir, fmt.Sprintf("workdir-%s.tar.gz", hash))
+	if _, err := os.Stat(path); err == nil {
+		// the modification time tells which archives were used last
+		now := time.Now()
+		return path, os.Chtimes(path, now, now)
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return "", err
+	}
+	// a crash never leaves a truncated archive behind
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := writeWorkdirArchive(tmp, files); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	return path, pruneWorkdirCache(cacheDir)
+}
+
+// private
+
+// lists all regular files, directories and symlinks, skipping ignored ones
+func listWorkdir(dir string, ignore *Ignore) ([]*workdirFile, error) {
+	files := []*workdirFile{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignore.Match(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			// the directory's files are walked next, its rules apply to them
+			if err := ignore.ReadDir(path, rel); err != nil {
+				return err
+			}
+		}
+
+		f := &workdirFile{path: path, rel: rel, info: info}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if f.link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case !info.IsDir() && !info.Mode().IsRegular():
+			// sockets, devices etc.
+			return nil
+		}
+		files = append(files, f)
+		return nil
+	})
+	return files, err
+}
+
+// hashes names, modes and contents of all files
+func hashWorkdir(files []*workdirFile) (string, error) {
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%o\x00%s\x00", f.rel, f.info.Mode(), f.link)
+		if f.info.Mode().IsRegular() {
+			if err := copyFile(h, f.path); err != nil {
+				return "", err
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// removes all but the WORKDIR_CACHE_SIZE archives used last
+func pruneWorkdirCache(cacheDir string) error {
+	archives, err := filepath.Glob(filepath.Join(cacheDir, "workdir-*.tar.gz"))
+	if err != nil || len(archives) <= WORKDIR_CACHE_SIZE {
+		return err
+	}
+	used := map[string]time.Time{}
+	for _, a := range archives {
+		if info, err := os.Stat(a); err == nil {
+			used[a] = info.ModTime()
+		}
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return used[archives[i]].After(used[archives[j]])
+	})
+	for _, a := range archives[WORKDIR_CACHE_SIZE:] {
+		if err := os.Remove(a); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeWorkdirArchive(path string, files []*workdirFile) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range files {
+		hdr, err := tar.FileInfoHeader(f.info, f.link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = f.rel
+		if f.info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if f.info.Mode().IsRegular() {
+			if err := copyFile(tw, f.path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
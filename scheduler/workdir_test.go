@@ -0,0 +1,180 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnoreMatch(t *testing.T) {
+	i := &Ignore{}
+	i.Add("# comment")
+	i.Add("*.o")
+	i.Add("/build")
+	i.Add("tmp/")
+	i.Add("docs/**/*.pdf")
+	i.Add("!keep.o")
+
+	assert.True(t, i.Match("main.o", false))
+	assert.True(t, i.Match("src/main.o", false))
+	assert.False(t, i.Match("keep.o", false))
+	assert.False(t, i.Match("main.go", false))
+
+	assert.True(t, i.Match("build", true))
+	assert.False(t, i.Match("src/build", true))
+
+	assert.True(t, i.Match("tmp", true))
+	assert.True(t, i.Match("src/tmp", true))
+	assert.False(t, i.Match("tmp", false))
+
+	assert.True(t, i.Match("docs/manual.pdf", false))
+	assert.True(t, i.Match("docs/a/b/manual.pdf", false))
+	assert.False(t, i.Match("manual.pdf", false))
+}
+
+func TestIgnorePatterns(t *testing.T) {
+	i := &Ignore{}
+	i.Add("file?.[ch]")
+	i.Add("log[!s]")
+
+	assert.True(t, i.Match("file1.c", false))
+	assert.True(t, i.Match("file2.h", false))
+	assert.False(t, i.Match("file10.c", false))
+	assert.True(t, i.Match("log1", false))
+	assert.False(t, i.Match("logs", false))
+}
+
+func writeWorkdir(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.Nil(t, ioutil.WriteFile(p, []byte(content), 0644))
+	}
+}
+
+func readArchive(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.Nil(t, err)
+	tr := tar.NewReader(gz)
+	names := []string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestArchiveWorkdir(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "none-workdir")
+	defer os.RemoveAll(dir)
+	work := filepath.Join(dir, "work")
+	cache := filepath.Join(dir, "cache")
+	writeWorkdir(t, work, map[string]string{
+		".git/HEAD":     "ref: refs/heads/master",
+		".gitignore":    "*.o\nbuild/\n",
+		".noneignore":   "!keep.o\nsecret.txt\n",
+		"main.go":       "package main",
+		"main.o":        "binary",
+		"keep.o":        "binary",
+		"secret.txt":    "secret",
+		"build/out":     "binary",
+		"src/lib.go":    "package src",
+		"src/build/out": "binary",
+	})
+
+	path, err := ArchiveWorkdir(work, cache)
+	assert.Nil(t, err)
+	assert.Equal(t, cache, filepath.Dir(path))
+	assert.Equal(t, []string{".gitignore", ".noneignore", "keep.o", "main.go", "src/", "src/lib.go"}, readArchive(t, path))
+
+	// unchanged workdirs reuse the archive, changes lead to a new one
+	again, err := ArchiveWorkdir(work, cache)
+	assert.Nil(t, err)
+	assert.Equal(t, path, again)
+
+	writeWorkdir(t, work, map[string]string{"main.go": "package main // changed"})
+	changed, err := ArchiveWorkdir(work, cache)
+	assert.Nil(t, err)
+	assert.NotEqual(t, path, changed)
+
+	// changes to ignored files don't matter
+	writeWorkdir(t, work, map[string]string{"main.o": "changed"})
+	ignored, err := ArchiveWorkdir(work, cache)
+	assert.Nil(t, err)
+	assert.Equal(t, changed, ignored)
+}
+
+func TestArchiveWorkdirNestedIgnoreFiles(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "none-workdir")
+	defer os.RemoveAll(dir)
+	work := filepath.Join(dir, "work")
+	writeWorkdir(t, work, map[string]string{
+		".gitignore":           "*.log\n",
+		"main.go":              "package main",
+		"app/.gitignore":       "/dist\n!keep.log\n",
+		"app/dist/app.js":      "bundle",
+		"app/keep.log":         "log",
+		"app/debug.log":        "log",
+		"app/src/dist/util.js": "util",
+		"lib/dist/lib.js":      "lib",
+		"lib/keep.log":         "log",
+	})
+
+	path, err := ArchiveWorkdir(work, filepath.Join(dir, "cache"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{".gitignore", "app/", "app/.gitignore", "app/keep.log", "app/src/", "app/src/dist/", "app/src/dist/util.js",
+		"lib/", "lib/dist/", "lib/dist/lib.js", "main.go"}, readArchive(t, path))
+}
+
+func TestArchiveWorkdirPrunesCache(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "none-workdir")
+	defer os.RemoveAll(dir)
+	work := filepath.Join(dir, "work")
+	cache := filepath.Join(dir, "cache")
+
+	archives := []string{}
+	for i := 0; i < WORKDIR_CACHE_SIZE; i++ {
+		writeWorkdir(t, work, map[string]string{"main.go": strings.Repeat("x", i)})
+		path, err := ArchiveWorkdir(work, cache)
+		assert.Nil(t, err)
+		// older archives were used earlier
+		used := time.Now().Add(time.Duration(i-WORKDIR_CACHE_SIZE) * time.Hour)
+		assert.Nil(t, os.Chtimes(path, used, used))
+		archives = append(archives, path)
+	}
+
+	// reusing the first archive keeps it, the second one is the oldest now
+	writeWorkdir(t, work, map[string]string{"main.go": ""})
+	path, err := ArchiveWorkdir(work, cache)
+	assert.Nil(t, err)
+	assert.Equal(t, archives[0], path)
+	for _, content := range []string{"changed", "changed again"} {
+		writeWorkdir(t, work, map[string]string{"main.go": content})
+		_, err = ArchiveWorkdir(work, cache)
+		assert.Nil(t, err)
+	}
+
+	cached, _ := filepath.Glob(filepath.Join(cache, "workdir-*.tar.gz"))
+	assert.Equal(t, WORKDIR_CACHE_SIZE, len(cached))
+	for i, a := range archives {
+		_, err := os.Stat(a)
+		assert.Equal(t, i == 1 || i == 2, os.IsNotExist(err), a)
+	}
+}
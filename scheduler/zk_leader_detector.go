@@ -12,16 +12,40 @@ import (
 )
 
 type LeaderDetector interface {
+	// waits for the first leader and keeps tracking leader changes afterwards
 	Detect(*string) (*string, error)
+	// returns the current leader, safe for concurrent use
+	Leader() string
+}
+
+// a master given as <ip:port> is always the leader
+type StaticLeaderDetector struct {
+	leader string
+}
+
+func NewStaticLeaderDetector(leader string) *StaticLeaderDetector {
+	return &StaticLeaderDetector{leader: leader}
+}
+
+func (d *StaticLeaderDetector) Detect(master *string) (*string, error) {
+	return master, nil
+}
+
+func (d *StaticLeaderDetector) Leader() string {
+	return d.leader
 }
 
 type ZkLeaderDetector struct {
-	newLeader chan *string
+	leader   string
+	mutex    chan bool
+	detected chan bool
+	detector *zoo.MasterDetector
 }
 
 func NewZkLeaderDetector() *ZkLeaderDetector {
 	return &ZkLeaderDetector{
-		newLeader: make(chan *string, 1),
+		mutex:    make(chan bool, 1),
+		detected: make(chan bool),
 	}
 }
 
@@ -33,9 +57,19 @@ func (d *ZkLeaderDetector) Detect(zkUrl *string) (*string, error) {
 	if err := ld.Detect(detector.OnMasterChanged(d.onLeaderChange)); err != nil {
 		return nil, fmt.Errorf("Failed to initialize master detector: %v", err)
 	}
+	// keep detecting for the lifetime of the process
+	d.detector = ld
+
+	// wait for callback to announce the first leader
+	<-d.detected
+	leader := d.Leader()
+	return &leader, nil
+}
 
-	// wait for callback to write new leader into this private channel
-	return <-d.newLeader, nil
+func (d *ZkLeaderDetector) Leader() string {
+	d.mutex <- true
+	defer func() { <-d.mutex }()
+	return d.leader
 }
 
 func (d *ZkLeaderDetector) onLeaderChange(info *mesos.MasterInfo) {
@@ -54,6 +88,13 @@ func (d *ZkLeaderDetector) onLeaderChange(info *mesos.MasterInfo) {
 		}
 		leader = fmt.Sprintf("%s:%d", leader, info.GetPort())
 		log.Infoln("New master in Zookeeper", leader)
-		d.newLeader <- &leader
+
+		d.mutex <- true
+		first := d.leader == ""
+		d.leader = leader
+		<-d.mutex
+		if first {
+			close(d.detected)
+		}
 	}
 }
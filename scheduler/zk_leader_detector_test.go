@@ -17,13 +17,18 @@ func (m *MockLeaderDetector) Detect(url *string) (*string, error) {
 	return args.Get(0).(*string), args.Error(1)
 }
 
+func (m *MockLeaderDetector) Leader() string {
+	args := m.Called()
+	return args.String(0)
+}
+
 func TestOnLeaderChangeIp(t *testing.T) {
 	d := NewZkLeaderDetector()
 	mi := util.NewMasterInfo("id", 0x01020304, 5050)
 
 	d.onLeaderChange(mi)
-	leader := <-d.newLeader
-	assert.Equal(t, *leader, "1.2.3.4:5050")
+	<-d.detected
+	assert.Equal(t, d.Leader(), "1.2.3.4:5050")
 }
 
 func TestOnLeaderChangeHostname(t *testing.T) {
@@ -33,6 +38,26 @@ func TestOnLeaderChangeHostname(t *testing.T) {
 	mi.Hostname = &host
 
 	d.onLeaderChange(mi)
-	leader := <-d.newLeader
-	assert.Equal(t, *leader, "2.3.4.5:5050")
+	<-d.detected
+	assert.Equal(t, d.Leader(), "2.3.4.5:5050")
+}
+
+func TestOnLeaderChangeFollowsLeader(t *testing.T) {
+	d := NewZkLeaderDetector()
+	d.onLeaderChange(util.NewMasterInfo("id", 0x01020304, 5050))
+	d.onLeaderChange(util.NewMasterInfo("id", 0x01020305, 5050))
+	d.onLeaderChange(nil)
+	d.onLeaderChange(util.NewMasterInfo("id", 0x01020306, 5050))
+
+	<-d.detected
+	assert.Equal(t, "1.2.3.6:5050", d.Leader())
+}
+
+func TestStaticLeaderDetector(t *testing.T) {
+	master := "1.2.3.4:5050"
+	d := NewStaticLeaderDetector(master)
+	leader, err := d.Detect(&master)
+	assert.Nil(t, err)
+	assert.Equal(t, master, *leader)
+	assert.Equal(t, master, d.Leader())
 }
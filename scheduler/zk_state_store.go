@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+const (
+	ZK_SESSION_TIMEOUT = 10 * time.Second
+	ZK_STATE_NODE      = "state"
+	ZK_LEADER_NODE     = "leader"
+	ZK_MEMBER_PREFIX   = "member-"
+)
+
+// the part of a zookeeper connection used by NONE, implemented by *zk.Conn
+type ZkConn interface {
+	Get(path string) ([]byte, *zk.Stat, error)
+	Set(path string, data []byte, version int32) (*zk.Stat, error)
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	Exists(path string) (bool, *zk.Stat, error)
+	ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+	Children(path string) ([]string, *zk.Stat, error)
+	Close()
+}
+
+// connects to zookeeper
+// returns the connection and the path of zkUrl <zk://host:port[,host:port]/path>
+func ConnectZk(zkUrl string) (ZkConn, string, error) {
+	if !strings.HasPrefix(zkUrl, "zk://") {
+		return nil, "", fmt.Errorf("Invalid zookeeper url %s", zkUrl)
+	}
+	hosts := strings.TrimPrefix(zkUrl, "zk://")
+	p := "/"
+	if i := strings.Index(hosts, "/"); i >= 0 {
+		hosts, p = hosts[:i], path.Clean(hosts[i:])
+	}
+	if hosts == "" || p == "/" {
+		return nil, "", fmt.Errorf("Invalid zookeeper url %s, expected zk://host:port/path", zkUrl)
+	}
+	conn, _, err := zk.Connect(strings.Split(hosts, ","), ZK_SESSION_TIMEOUT)
+	if err != nil {
+		return nil, "", err
+	}
+	return conn, p, nil
+}
+
+// stores the state as JSON in a zookeeper node below path
+type ZkStateStore struct {
+	conn ZkConn
+	path string
+}
+
+func NewZkStateStore(conn ZkConn, path string) *ZkStateStore {
+	return &ZkStateStore{
+		conn: conn,
+		path: path,
+	}
+}
+
+func (s *ZkStateStore) Load() (*State, error) {
+	data, _, err := s.conn.Get(s.statePath())
+	if err == zk.ErrNoNode {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("Invalid state in %s: %s", s.statePath(), err)
+	}
+	return &state, nil
+}
+
+func (s *ZkStateStore) Save(state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Set(s.statePath(), data, -1)
+	if err == zk.ErrNoNode {
+		if err := createZkPath(s.conn, s.path); err != nil {
+			return err
+		}
+		_, err = s.conn.Create(s.statePath(), data, 0, zk.WorldACL(zk.PermAll))
+	}
+	return err
+}
+
+// keeps a completed state, standby instances must not start the run again
+func (s *ZkStateStore) Complete() error {
+	return s.Save(&State{Complete: true})
+}
+
+func (s *ZkStateStore) statePath() string {
+	return path.Join(s.path, ZK_STATE_NODE)
+}
+
+// elects a leader among all NONE instances sharing a zookeeper path
+// each instance creates an ephemeral sequential node, the one with the lowest sequence number leads
+type ZkLeaderElection struct {
+	conn ZkConn
+	path string
+	id   string
+	node string
+	// the leader keeps leading this long without reaching zookeeper, the session expires afterwards
+	sessionTimeout time.Duration
+}
+
+func NewZkLeaderElection(conn ZkConn, path, id string) *ZkLeaderElection {
+	return &ZkLeaderElection{
+		conn:           conn,
+		path:           path,
+		id:             id,
+		sessionTimeout: ZK_SESSION_TIMEOUT,
+	}
+}
+
+// blocks until this instance is the leader
+func (e *ZkLeaderElection) Elect() error {
+	dir := path.Join(e.path, ZK_LEADER_NODE)
+	if e.node == "" {
+		if err := createZkPath(e.conn, dir); err != nil {
+			return err
+		}
+		node, err := e.conn.Create(path.Join(dir, ZK_MEMBER_PREFIX), []byte(e.id), zk.FlagEphemeral|zk.FlagSequence, zk.WorldACL(zk.PermAll))
+		if err != nil {
+			return err
+		}
+		e.node = node
+	}
+
+	for {
+		members, _, err := e.conn.Children(dir)
+		if err != nil {
+			return err
+		}
+		sort.Strings(members)
+		predecessor := ""
+		for _, m := range members {
+			if path.Join(dir, m) == e.node {
+				break
+			}
+			predecessor = path.Join(dir, m)
+		}
+		if predecessor == "" {
+			log.Infoln("Elected as leader", e.node)
+			return nil
+		}
+
+		// wait for the instance in front of us to go away
+		log.Infoln("Waiting for", predecessor, "to give up leadership")
+		exists, _, events, err := e.conn.ExistsW(predecessor)
+		if err != nil {
+			return err
+		}
+		if exists {
+			<-events
+		}
+	}
+}
+
+// calls lost once this instance's node is gone, e.g. after the zookeeper session expired
+// the client reconnects after connection errors, they are retried until the session must have expired
+func (e *ZkLeaderElection) Watch(lost func()) {
+	go func() {
+		var failing time.Time
+		for {
+			exists, _, events, err := e.conn.ExistsW(e.node)
+			if err == nil && !exists || err == zk.ErrSessionExpired {
+				lost()
+				return
+			}
+			if err != nil {
+				if failing.IsZero() {
+					failing = time.Now()
+				}
+				if time.Since(failing) > e.sessionTimeout {
+					log.Errorln("Unable to reach zookeeper for", e.sessionTimeout, "giving up leadership:", err)
+					lost()
+					return
+				}
+				log.Warningln("Unable to watch leadership, retrying:", err)
+				time.Sleep(e.sessionTimeout / 10)
+				continue
+			}
+			failing = time.Time{}
+			<-events
+		}
+	}()
+}
+
+// creates all missing nodes of path
+func createZkPath(conn ZkConn, p string) error {
+	node := ""
+	for _, name := range strings.Split(strings.Trim(p, "/"), "/") {
+		node += "/" + name
+		_, err := conn.Create(node, []byte{}, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
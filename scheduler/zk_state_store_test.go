@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+// in-process zookeeper, shared by all instances using it
+type fakeZkConn struct {
+	mutex    sync.Mutex
+	nodes    map[string][]byte
+	watches  map[string][]chan zk.Event
+	sequence int
+	// returned by ExistsW if set, e.g. while disconnected
+	err error
+}
+
+func newFakeZkConn() *fakeZkConn {
+	return &fakeZkConn{
+		nodes:   map[string][]byte{"/": nil},
+		watches: make(map[string][]chan zk.Event),
+	}
+}
+
+func (c *fakeZkConn) Get(p string) ([]byte, *zk.Stat, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data, ok := c.nodes[p]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return data, &zk.Stat{}, nil
+}
+
+func (c *fakeZkConn) Set(p string, data []byte, version int32) (*zk.Stat, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.nodes[p]; !ok {
+		return nil, zk.ErrNoNode
+	}
+	c.nodes[p] = data
+	c.fire(p, zk.EventNodeDataChanged)
+	return &zk.Stat{}, nil
+}
+
+func (c *fakeZkConn) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.nodes[path.Dir(p)]; !ok {
+		return "", zk.ErrNoNode
+	}
+	if flags&zk.FlagSequence != 0 {
+		p = fmt.Sprintf("%s%010d", p, c.sequence)
+		c.sequence++
+	}
+	if _, ok := c.nodes[p]; ok {
+		return "", zk.ErrNodeExists
+	}
+	c.nodes[p] = data
+	c.fire(p, zk.EventNodeCreated)
+	return p, nil
+}
+
+func (c *fakeZkConn) Delete(p string, version int32) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.nodes[p]; !ok {
+		return zk.ErrNoNode
+	}
+	delete(c.nodes, p)
+	c.fire(p, zk.EventNodeDeleted)
+	return nil
+}
+
+func (c *fakeZkConn) Exists(p string) (bool, *zk.Stat, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, ok := c.nodes[p]
+	return ok, &zk.Stat{}, nil
+}
+
+func (c *fakeZkConn) ExistsW(p string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return false, nil, nil, c.err
+	}
+	_, ok := c.nodes[p]
+	w := make(chan zk.Event, 1)
+	c.watches[p] = append(c.watches[p], w)
+	return ok, &zk.Stat{}, w, nil
+}
+
+func (c *fakeZkConn) Children(p string) ([]string, *zk.Stat, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.nodes[p]; !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	children := []string{}
+	for n := range c.nodes {
+		if n != "/" && path.Dir(n) == p {
+			children = append(children, strings.TrimPrefix(n, p+"/"))
+		}
+	}
+	return children, &zk.Stat{}, nil
+}
+
+func (c *fakeZkConn) Close() {}
+
+// fails ExistsW with err and fires the watches of p like a lost connection
+func (c *fakeZkConn) disconnect(p string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.err = err
+	if err != nil {
+		c.fire(p, zk.EventNotWatching)
+	}
+}
+
+// watches fire once
+func (c *fakeZkConn) fire(p string, t zk.EventType) {
+	for _, w := range c.watches[p] {
+		w <- zk.Event{Type: t, Path: p}
+	}
+	delete(c.watches, p)
+}
+
+// tests
+
+func TestZkStateStore(t *testing.T) {
+	s := NewZkStateStore(newFakeZkConn(), "/none/job")
+	state, err := s.Load()
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	saved := &State{FrameworkId: "framework", Commands: []*CommandState{{Id: "1", Cmd: "ls"}}}
+	assert.NoError(t, s.Save(saved))
+	assert.NoError(t, s.Save(saved), "existing state should be overwritten")
+	state, err = s.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, saved, state)
+
+	assert.NoError(t, s.Complete())
+	state, err = s.Load()
+	assert.NoError(t, err)
+	assert.True(t, state.Complete)
+}
+
+func TestZkLeaderElection(t *testing.T) {
+	conn := newFakeZkConn()
+	primary := NewZkLeaderElection(conn, "/none/job", "primary")
+	standby := NewZkLeaderElection(conn, "/none/job", "standby")
+	assert.NoError(t, primary.Elect())
+
+	lost := make(chan bool, 1)
+	primary.Watch(func() { lost <- true })
+
+	elected := make(chan error, 1)
+	go func() { elected <- standby.Elect() }()
+	select {
+	case <-elected:
+		t.Fatal("standby should wait for the primary")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// the primary's session expires
+	assert.NoError(t, conn.Delete(primary.node, -1))
+	select {
+	case err := <-elected:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("standby should be elected")
+	}
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("primary should notice the lost leadership")
+	}
+}
+
+func TestZkLeaderElectionSurvivesConnectionLoss(t *testing.T) {
+	conn := newFakeZkConn()
+	primary := NewZkLeaderElection(conn, "/none/job", "primary")
+	primary.sessionTimeout = 200 * time.Millisecond
+	assert.NoError(t, primary.Elect())
+
+	lost := make(chan bool, 1)
+	primary.Watch(func() { lost <- true })
+
+	conn.disconnect(primary.node, zk.ErrConnectionClosed)
+	time.Sleep(50 * time.Millisecond)
+	conn.disconnect(primary.node, nil)
+	select {
+	case <-lost:
+		t.Fatal("primary should keep leading after reconnecting")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	conn.disconnect(primary.node, zk.ErrConnectionClosed)
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("primary should give up once the session must have expired")
+	}
+}
+
+func TestConnectZkInvalidUrl(t *testing.T) {
+	_, _, err := ConnectZk("localhost:2181/none")
+	assert.Error(t, err)
+	_, _, err = ConnectZk("zk://localhost:2181")
+	assert.Error(t, err)
+}